@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newAnalyzeValuesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze-values -c CHART",
+		Short: "Find the values keys which have no effect on the manifests",
+		Long: `
+Find the values keys which have no effect on the manifests.
+
+Each leaf key of the chart's values.yaml is perturbed (booleans are toggled, numbers are incremented and strings are changed)
+and the chart is rendered again with the default values and every test values file.
+A key is reported as dead if the manifests do not change in any of them.
+The keys set by the test values files are reported as exercised by the test cases.
+`,
+		Example: `
+  # Analyze the values keys with the default values:
+  chartsnap analyze-values -c YOUR_CHART
+
+  # Analyze the values keys with your test values in JSON:
+  chartsnap analyze-values -c YOUR_CHART -f YOUR_TEST_VALUES_FILES_DIRECTOY --format json`,
+		RunE: runAnalyzeValues,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory or remote chart name")
+	if err := cmd.MarkFlagRequired("chart"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&o.Format, "format", charts.CoverageFormatText, "output format of the report. text or json")
+	return cmd
+}
+
+func runAnalyzeValues(cmd *cobra.Command, args []string) error {
+	switch o.Format {
+	case charts.CoverageFormatText, charts.CoverageFormatJSON:
+	default:
+		return fmt.Errorf("invalid --format '%s'. text or json is supported", o.Format)
+	}
+
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+	values, err := loadTestValues(&cfg)
+	if err != nil {
+		return err
+	}
+	// the default values are always analyzed
+	values = slices.DeleteFunc(values, func(v string) bool { return v == "" })
+
+	if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+		return err
+	}
+	chart, helmArgs, err := fetchChart(cmd.Context(), o.Chart, args)
+	if err != nil {
+		return err
+	}
+
+	analyzer := &charts.ValuesAnalyzer{
+		HelmTemplateCmdOptions: charts.HelmTemplateCmdOptions{
+			HelmPath:       o.HelmBin(),
+			ReleaseName:    o.ReleaseName,
+			Namespace:      o.Namespace(),
+			Chart:          chart,
+			AdditionalArgs: helmArgs,
+		},
+		SnapshotConfig:  cfg,
+		TestValuesFiles: values,
+		Parallelism:     o.Parallelism,
+	}
+	if o.Debug() {
+		analyzer.Parallelism = 1
+	}
+	bannerPrintln("RUNS", fmt.Sprintf("Analyzing values keys of chart=%s with %d test values files", o.Chart, len(values)), 0, color.BgBlue)
+	report, err := analyzer.Analyze(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	out, err := report.Format(o.Format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	bannerPrintln("DONE", fmt.Sprintf("%d of %d values keys have no effect on the manifests", report.Dead, report.Total), 0, color.BgBlue)
+	return nil
+}
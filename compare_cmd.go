@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newCompareCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare -c CHART --from-version VERSION --to-version VERSION",
+		Short: "Compare the manifests of two chart versions with the same test values",
+		Long: `
+Compare the manifests of two chart versions with the same test values.
+
+Both versions of the remote chart are rendered for every test case and the diff of the manifests is printed per test case.
+The dynamic fields in the config file or testSpec are replaced with fixed values in both, and no snapshot is written.
+`,
+		Example: `
+  # Compare the manifests of your test values between the chart versions:
+  chartsnap compare -c ingress-nginx --from-version 4.8.3 --to-version 4.9.0 -f YOUR_TEST_VALUES_DIRECTORY -- --repo https://kubernetes.github.io/ingress-nginx
+
+  # Write the diff into a markdown report:
+  chartsnap compare -c oci://ghcr.io/nginxinc/charts/nginx-gateway-fabric --from-version 1.1.0 --to-version 1.2.0 --report report.md`,
+		RunE: runCompare,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "remote chart name or OCI reference. '--repo' can be passed to 'helm template' after '--'")
+	if err := cmd.MarkFlagRequired("chart"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&o.FromVersion, "from-version", "", "chart version to compare from")
+	if err := cmd.MarkFlagRequired("from-version"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&o.ToVersion, "to-version", "", "chart version to compare to")
+	if err := cmd.MarkFlagRequired("to-version"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&o.ReportFile, "report", "", "path to write the diff of each test case as a markdown report")
+	return cmd
+}
+
+type compareCase struct {
+	name   string
+	result *charts.CompareResult
+}
+
+func runCompare(cmd *cobra.Command, args []string) error {
+	if remote, _ := charts.ParseRemoteChart(o.Chart, args); remote == nil {
+		return fmt.Errorf("chart '%s' is not a remote chart. set an OCI reference or '--repo' after '--'", o.Chart)
+	} else if remote.Version != "" {
+		return fmt.Errorf("--version cannot be set with --from-version and --to-version")
+	}
+
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+	values, err := loadTestValues(&cfg)
+	if err != nil {
+		return err
+	}
+
+	fromChart, fromArgs, err := fetchChart(cmd.Context(), o.Chart, append(slices.Clone(args), "--version="+o.FromVersion))
+	if err != nil {
+		return fmt.Errorf("failed to fetch chart version %s: %w", o.FromVersion, err)
+	}
+	toChart, toArgs, err := fetchChart(cmd.Context(), o.Chart, append(slices.Clone(args), "--version="+o.ToVersion))
+	if err != nil {
+		return fmt.Errorf("failed to fetch chart version %s: %w", o.ToVersion, err)
+	}
+
+	cases, err := compareTestCases(cmd.Context(), cfg, values, func(ht charts.HelmTemplateCmdOptions) (from, to charts.HelmTemplateCmdOptions) {
+		from, to = ht, ht
+		from.Chart, from.AdditionalArgs = fromChart, fromArgs
+		to.Chart, to.AdditionalArgs = toChart, toArgs
+		return from, to
+	})
+	if err != nil {
+		return err
+	}
+	changed := printCompareCases(cases, o.FromVersion, o.ToVersion)
+
+	if o.ReportFile != "" {
+		if err := os.WriteFile(o.ReportFile, []byte(compareReport(cases)), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		log.Info("report written", "path", o.ReportFile)
+	}
+	bannerPrintln("DONE", fmt.Sprintf("%d of %d test cases rendered differently between %s and %s", changed, len(cases), o.FromVersion, o.ToVersion), 0, color.BgBlue)
+	return nil
+}
+
+// compareTestCases renders every test case by the from and to options given by the function and compares the manifests in parallel.
+// The results are returned in the order of the test cases.
+func compareTestCases(ctx context.Context, cfg v1alpha1.SnapshotConfig, values []string, options func(ht charts.HelmTemplateCmdOptions) (from, to charts.HelmTemplateCmdOptions)) ([]*compareCase, error) {
+	matrix, err := testMatrix(values, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cases := make([]*compareCase, 0)
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(o.Parallelism)
+	if o.Debug() {
+		eg.SetLimit(1)
+	}
+	for _, v := range values {
+		for _, m := range matrix[v] {
+			from, to := options(charts.HelmTemplateCmdOptions{
+				HelmPath:    o.HelmBin(),
+				ReleaseName: o.ReleaseName,
+				Namespace:   o.Namespace(),
+				ValuesFile:  v,
+				KubeVersion: m.KubeVersion,
+				APIVersions: m.APIVersions,
+			})
+
+			c := &compareCase{name: fmt.Sprintf("values=%s", v)}
+			if m.ID() != "" {
+				c.name += fmt.Sprintf(" matrix=%s", m.ID())
+			}
+			cases = append(cases, c)
+
+			eg.Go(func() error {
+				result, err := charts.Compare(ctx,
+					&charts.ChartSnapshotter{HelmTemplateCmdOptions: from, SnapshotConfig: cfg, FailHelmError: o.FailHelmError},
+					&charts.ChartSnapshotter{HelmTemplateCmdOptions: to, SnapshotConfig: cfg, FailHelmError: o.FailHelmError},
+					o.DiffContextLineN)
+				if err != nil {
+					return fmt.Errorf("failed to compare %s: %w", c.name, err)
+				}
+				c.result = result
+				return nil
+			})
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// printCompareCases prints the diff of each test case and returns the number of the changed test cases.
+func printCompareCases(cases []*compareCase, from, to string) int {
+	changed := 0
+	for _, c := range cases {
+		msg := fmt.Sprintf("chart=%s %s from=%s to=%s", o.Chart, c.name, from, to)
+		if c.result.Equal {
+			bannerPrintln("SAME", msg, color.FgGreen, color.BgGreen)
+			continue
+		}
+		changed++
+		bannerPrintln("DIFF", msg, color.FgYellow, color.BgYellow)
+		fmt.Println(c.result.Diff)
+	}
+	return changed
+}
+
+var ansiExp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// compareReport returns the markdown report of the compare results.
+func compareReport(cases []*compareCase) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Chart comparison report\n\n")
+	fmt.Fprintf(&sb, "- chart: `%s`\n- from: `%s`\n- to: `%s`\n", o.Chart, o.FromVersion, o.ToVersion)
+	for _, c := range cases {
+		fmt.Fprintf(&sb, "\n## %s\n\n", c.name)
+		if c.result.Equal {
+			sb.WriteString("No changes.\n")
+			continue
+		}
+		fmt.Fprintf(&sb, "```diff\n%s\n```\n", strings.TrimRight(ansiExp.ReplaceAllString(c.result.Diff, ""), "\n"))
+	}
+	return sb.String()
+}
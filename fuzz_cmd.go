@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newFuzzCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fuzz -c CHART",
+		Short: "Render the chart with random values to find the inputs breaking it",
+		Long: `
+Render the chart with random values to find the inputs breaking it.
+
+Random but type-consistent values overrides are generated from the chart's values.yaml and values.schema.json.
+The types and the enums in values.schema.json take precedence over the types of the default values.
+The inputs which make 'helm template' fail, render invalid YAML (kind: Unknown) or render the same resource identity
+(API group, kind, namespace and name) more than once are reported with the keys minimized.
+If --output-dir is set, the minimized inputs are saved as new test values files.
+The same seed generates the same inputs. The seed is printed to reproduce the run.
+`,
+		Example: `
+  # Fuzz the chart 100 times:
+  chartsnap fuzz -c YOUR_CHART
+
+  # Reproduce a run and save the failing inputs as test values files:
+  chartsnap fuzz -c YOUR_CHART --iterations 500 --seed 1234 -o YOUR_CHART/tests`,
+		RunE: runFuzz,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory or remote chart name")
+	if err := cmd.MarkFlagRequired("chart"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().IntVar(&o.Iterations, "iterations", 100, "number of the random values overrides")
+	cmd.Flags().Int64Var(&o.Seed, "seed", 0, "seed of the random values overrides. a seed based on the current time is used if 0")
+	return cmd
+}
+
+func runFuzz(cmd *cobra.Command, args []string) error {
+	if o.Iterations <= 0 {
+		return fmt.Errorf("invalid --iterations %d. must be positive", o.Iterations)
+	}
+	seed := o.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+		return err
+	}
+	chart, helmArgs, err := fetchChart(cmd.Context(), o.Chart, args)
+	if err != nil {
+		return err
+	}
+
+	fuzzer := &charts.Fuzzer{
+		HelmTemplateCmdOptions: charts.HelmTemplateCmdOptions{
+			HelmPath:       o.HelmBin(),
+			ReleaseName:    o.ReleaseName,
+			Namespace:      o.Namespace(),
+			Chart:          chart,
+			AdditionalArgs: helmArgs,
+		},
+		Iterations:  o.Iterations,
+		Seed:        seed,
+		Parallelism: o.Parallelism,
+	}
+	if o.Debug() {
+		fuzzer.Parallelism = 1
+	}
+	bannerPrintln("RUNS", fmt.Sprintf("Fuzzing chart=%s with %d iterations seed=%d", o.Chart, o.Iterations, seed), 0, color.BgBlue)
+	failures, err := fuzzer.Run(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if o.OutputDir != "" && len(failures) > 0 {
+		if err := os.MkdirAll(o.OutputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	for _, f := range failures {
+		bannerPrintln("FAIL", fmt.Sprintf("%s at iteration %d: %s", f.Kind, f.Iteration, f.Message), color.FgRed, color.BgRed)
+		fmt.Print(string(f.Values))
+		if o.OutputDir == "" {
+			continue
+		}
+		p := path.Join(o.OutputDir, fmt.Sprintf("test_fuzz_%d_%d.yaml", seed, f.Iteration))
+		header := fmt.Sprintf("# generated by chartsnap fuzz: seed=%d iteration=%d\n# %s: %s\n", seed, f.Iteration, f.Kind, strings.ReplaceAll(f.Message, "\n", "\n# "))
+		if writeIfNotExist(p, append([]byte(header), f.Values...)) {
+			log.Info("test values file written", "path", p)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d failures found by fuzzing. reproduce with --seed %d", len(failures), seed)
+	}
+	bannerPrintln("PASS", fmt.Sprintf("No failures found in %d iterations seed=%d", o.Iterations, seed), color.FgGreen, color.BgGreen)
+	return nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path"
@@ -28,21 +31,52 @@ var (
 	o       *option
 	rootCmd *cobra.Command
 	log     *slog.Logger
+
+	// dependencyBuilder is shared by the test cases and the commands to build the dependencies once per chart in a process
+	dependencyBuilder *charts.DependencyBuilder
+	// chartFetcher is shared by the commands to fetch the remote charts once per chart and version in a process
+	chartFetcher *charts.ChartFetcher
 )
 
 type option struct {
-	ReleaseName      string
-	Chart            string
-	ValuesFile       string
-	UpdateSnapshot   bool
-	OutputDir        string
-	DiffContextLineN int
-	FailFast         bool
-	Parallelism      int
-	ConfigFile       string
-	LegacySnapshot   bool // deprecated
-	SnapshotVersion  string
-	FailHelmError    bool
+	ReleaseName          string
+	Chart                string
+	ValuesFile           string
+	UpdateSnapshot       bool
+	OutputDir            string
+	DiffContextLineN     int
+	FailFast             bool
+	Parallelism          int
+	ConfigFile           string
+	LegacySnapshot       bool // deprecated
+	SnapshotVersion      string
+	FailHelmError        bool
+	Stdin                bool
+	SnapshotName         string
+	CacheDir             string
+	SkipDepBuild         bool
+	Offline              bool
+	ChartVersionMismatch string
+	MigrateTo            string
+	DryRun               bool
+	FromVersion          string
+	ToVersion            string
+	ReportFile           string
+	AgainstRef           string
+	ValidateSchema       bool
+	ValidateCRDs         bool
+	SchemaDirs           []string
+	ValidateReferences   bool
+	CRDDirs              []string
+	TargetKubeVersion    string
+	DeprecatedAPI        string
+	DuplicateResource    string
+	TemplateCoverage     string
+	TemplateCoverageFile string
+	MinTemplateCoverage  float64
+	Format               string
+	Iterations           int
+	Seed                 int64
 
 	// Below properties are the same as helm global options
 	// They are passed to the plugin as environment variables
@@ -81,6 +115,13 @@ func (o *option) OK() string {
 	return "matched"
 }
 
+func (o *option) cacheDir() string {
+	if o.CacheDir != "" {
+		return o.CacheDir
+	}
+	return charts.DefaultCacheDir()
+}
+
 // compatibility for --legacy-snapshot flag
 func (o *option) snapshotVersion() string {
 	// use v1 snapshot format if legacy snapshot format is enabled
@@ -97,6 +138,8 @@ func init() {
 
 func initRootCmd() {
 	o = &option{}
+	dependencyBuilder = nil
+	chartFetcher = nil
 	rootCmd = &cobra.Command{
 		Use:   "chartsnap -c CHART",
 		Short: "Snapshot testing tool for Helm charts",
@@ -147,6 +190,9 @@ MIT 2023 jlandowner/helm-chartsnap
   # Set additional args or flags for the 'helm template' command:
   chartsnap -c YOUR_CHART -f YOUR_TEST_VALUES_FILE -- --skip-tests
 
+  # Show the diff of the manifests from the main branch without snapshots:
+  chartsnap -c YOUR_CHART -f YOUR_TEST_VALUES_FILES_DIRECTOY --against-ref main
+
   # Snapshot remote chart in Helm repository:
   chartsnap -c CHART_NAME -f YOUR_VALUES_FILE -- --repo HELM_REPO_URL
 
@@ -161,18 +207,20 @@ MIT 2023 jlandowner/helm-chartsnap
 
   # Output with no colors:
   NO_COLOR=1 chartsnap -c YOUR_CHART`,
-		Version: fmt.Sprintf("version=%s commit=%s date=%s", version, commit, date),
-		RunE:    run,
+		Version:           fmt.Sprintf("version=%s commit=%s date=%s", version, commit, date),
+		Args:              cobra.ArbitraryArgs,
+		PersistentPreRunE: setup,
+		RunE:              run,
 	}
 	rootCmd.SilenceUsage = true
 	rootCmd.SilenceErrors = true
 	rootCmd.PersistentFlags().BoolVar(&o.DebugFlag, "debug", false, "debug mode")
 	rootCmd.PersistentFlags().BoolVarP(&o.UpdateSnapshot, "update-snapshot", "u", false, "update snapshot mode")
-	rootCmd.PersistentFlags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory. this flag is passed to 'helm template RELEASE_NAME CHART --values VALUES' as 'CHART'")
-	if err := rootCmd.MarkPersistentFlagDirname("chart"); err != nil {
+	rootCmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory. this flag is passed to 'helm template RELEASE_NAME CHART --values VALUES' as 'CHART'")
+	if err := rootCmd.MarkFlagDirname("chart"); err != nil {
 		panic(err)
 	}
-	if err := rootCmd.MarkPersistentFlagRequired("chart"); err != nil {
+	if err := rootCmd.MarkFlagRequired("chart"); err != nil {
 		panic(err)
 	}
 	rootCmd.PersistentFlags().StringVar(&o.ReleaseName, "release-name", "chartsnap", "release name. this flag is passed to 'helm template RELEASE_NAME CHART --values VALUES' as 'RELEASE_NAME'")
@@ -193,17 +241,43 @@ MIT 2023 jlandowner/helm-chartsnap
 	rootCmd.PersistentFlags().MarkDeprecated("legacy-snapshot", "use --snapshot-version=v1 instead")
 	rootCmd.PersistentFlags().StringVar(&o.SnapshotVersion, "snapshot-version", "", "use a specific snapshot format version. v1, v2, v3 are supported. (default: latest)")
 	rootCmd.PersistentFlags().BoolVar(&o.FailHelmError, "fail-helm-error", false, "fail if 'helm template' command failed")
+	rootCmd.PersistentFlags().BoolVar(&o.SkipDepBuild, "skip-dependency-build", false, "skip 'helm dependency build' for the stale dependencies of the local chart")
+	rootCmd.PersistentFlags().StringVar(&o.ChartVersionMismatch, "chart-version-mismatch", charts.ChartVersionMismatchWarn, "action when the chart version in the snapshot header differs from the rendered chart. ignore, warn or fail")
+	rootCmd.PersistentFlags().BoolVar(&o.ValidateSchema, "validate-schema", false, "validate the rendered resources against the Kubernetes schemas and fail on unknown fields or type errors")
+	rootCmd.PersistentFlags().StringSliceVar(&o.SchemaDirs, "schema-dir", nil, "directories of the JSON schemas in the kubeconform layout for the schema validation. if not found, the built-in types bundled in chartsnap are used")
+	rootCmd.PersistentFlags().BoolVar(&o.ValidateCRDs, "validate-crds", false, "validate the custom resources against the schemas of the CustomResourceDefinitions and fail on unknown fields or type errors")
+	rootCmd.PersistentFlags().StringSliceVar(&o.CRDDirs, "crd-dir", nil, "directories of the CustomResourceDefinitions for --validate-crds in addition to the 'crds' directory of the chart and the rendered CRDs")
+	rootCmd.PersistentFlags().BoolVar(&o.ValidateReferences, "validate-references", false, "check the references between the rendered resources such as Service selectors, Ingress backends, ConfigMaps, Secrets and Roles and fail on broken ones")
+	rootCmd.PersistentFlags().StringVar(&o.TargetKubeVersion, "target-kube-version", "", "check the rendered resources for deprecated or removed APIs in the Kubernetes version. e.g. 1.29")
+	rootCmd.PersistentFlags().StringVar(&o.DeprecatedAPI, "deprecated-api", charts.DeprecatedAPIWarn, "action when deprecated or removed APIs are found by --target-kube-version. warn or fail")
+	rootCmd.PersistentFlags().StringVar(&o.DuplicateResource, "duplicate-resource", charts.DuplicateResourceWarn, "action when resources of the same API group, kind, namespace and name are rendered. warn or fail")
+	rootCmd.PersistentFlags().BoolVar(&o.Offline, "offline", false, "use the cached remote charts without accessing the network")
+	rootCmd.Flags().StringVar(&o.AgainstRef, "against-ref", "", "render the chart and test values at the git ref in a temporary worktree and show the diff with the working tree instead of matching snapshots")
+	rootCmd.Flags().StringVar(&o.TemplateCoverage, "template-coverage", "", "report which templates and if branches of the chart were rendered in the test cases. text or json")
+	rootCmd.Flags().StringVar(&o.TemplateCoverageFile, "template-coverage-file", "", "path to write the template coverage report instead of stdout")
+	rootCmd.Flags().Float64Var(&o.MinTemplateCoverage, "min-template-coverage", 0, "fail if the percentage of the templates rendered in the test cases is below the value. e.g. 80")
+	rootCmd.PersistentFlags().StringVar(&o.CacheDir, "cache-dir", "", "directory to cache downloaded charts. (default: $HELM_CACHE_HOME/chartsnap if set; else user cache directory)")
+
+	rootCmd.AddCommand(newSnapCmd())
+	rootCmd.AddCommand(newRenderCmd())
+	rootCmd.AddCommand(newMigrateCmd())
+	rootCmd.AddCommand(newCompareCmd())
+	rootCmd.AddCommand(newAnalyzeValuesCmd())
+	rootCmd.AddCommand(newScaffoldCmd())
+	rootCmd.AddCommand(newFuzzCmd())
+	rootCmd.AddCommand(newMutateCmd())
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		slog.New(slogHandler()).Error(err.Error())
+		slog.New(slogHandler(os.Stdout)).Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func slogHandler() slog.Handler {
+func slogHandler(w io.Writer) slog.Handler {
 	return clog.New(
+		clog.WithWriter(w),
 		clog.WithColor(true),
 		clog.WithSource(true),
 		clog.WithLevel(func() slog.Leveler {
@@ -228,8 +302,16 @@ func loadSnapshotConfig(file string, cfg *v1alpha1.SnapshotConfig) error {
 	return nil
 }
 
-func run(cmd *cobra.Command, args []string) error {
-	log = slog.New(slogHandler())
+// logToStderrAnnotation is the annotation of the commands which print manifests to stdout.
+// They write the logs to stderr not to mix them with the manifests.
+const logToStderrAnnotation = "chartsnap/log-to-stderr"
+
+func setup(cmd *cobra.Command, args []string) error {
+	var w io.Writer = os.Stdout
+	if _, ok := cmd.Annotations[logToStderrAnnotation]; ok {
+		w = cmd.ErrOrStderr()
+	}
+	log = slog.New(slogHandler(w))
 	log.Debug("options", printOptions(*o)...)
 	log.Debug("args", "args", args)
 	charts.SetLogger(log)
@@ -247,36 +329,300 @@ func run(cmd *cobra.Command, args []string) error {
 		// https://github.com/jlandowner/helm-chartsnap/issues/149#issuecomment-2562030457
 		color.NoColor = false
 	}
+	return validateActions()
+}
+
+// validateActions validates the actions of the persistent flags which all the commands accept
+func validateActions() error {
+	switch o.ChartVersionMismatch {
+	case charts.ChartVersionMismatchIgnore, charts.ChartVersionMismatchWarn, charts.ChartVersionMismatchFail:
+	default:
+		return fmt.Errorf("invalid --chart-version-mismatch '%s'. ignore, warn or fail is supported", o.ChartVersionMismatch)
+	}
+	switch o.DeprecatedAPI {
+	case charts.DeprecatedAPIWarn, charts.DeprecatedAPIFail:
+	default:
+		return fmt.Errorf("invalid --deprecated-api '%s'. warn or fail is supported", o.DeprecatedAPI)
+	}
+	switch o.DuplicateResource {
+	case charts.DuplicateResourceWarn, charts.DuplicateResourceFail:
+	default:
+		return fmt.Errorf("invalid --duplicate-resource '%s'. warn or fail is supported", o.DuplicateResource)
+	}
+	switch o.TemplateCoverage {
+	case "", charts.CoverageFormatText, charts.CoverageFormatJSON:
+	default:
+		return fmt.Errorf("invalid --template-coverage '%s'. text or json is supported", o.TemplateCoverage)
+	}
+	if o.AgainstRef != "" && (o.TemplateCoverage != "" || o.TemplateCoverageFile != "" || o.MinTemplateCoverage > 0) {
+		// --against-ref does not match snapshots, so the template coverage is not collected
+		return fmt.Errorf("--template-coverage, --template-coverage-file and --min-template-coverage cannot be used with --against-ref")
+	}
+	return nil
+}
 
-	var cfg v1alpha1.SnapshotConfig
+// loadDefaultSnapshotConfig loads the config file in the current directory if exists
+func loadDefaultSnapshotConfig(cfg *v1alpha1.SnapshotConfig) error {
 	if _, err := os.Stat(o.ConfigFile); err == nil {
-		if err := loadSnapshotConfig(o.ConfigFile, &cfg); err != nil {
+		if err := loadSnapshotConfig(o.ConfigFile, cfg); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+
+	values, err := loadTestValues(&cfg)
+	if err != nil {
+		return err
+	}
+	matrix, err := testMatrix(values, cfg)
+	if err != nil {
+		return err
+	}
+
+	// build dependencies or fetch the remote chart once before rendering test cases in parallel
+	if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+		return err
+	}
+	if o.AgainstRef != "" {
+		return runAgainstRef(cmd.Context(), cfg, values, args)
+	}
+	chart, helmArgs, err := fetchChart(cmd.Context(), o.Chart, args)
+	if err != nil {
+		return err
+	}
 
+	var coverage *charts.TemplateCoverage
+	if o.TemplateCoverage != "" || o.TemplateCoverageFile != "" || o.MinTemplateCoverage > 0 {
+		if coverage, err = charts.NewTemplateCoverage(chart); err != nil {
+			return err
+		}
+		defer coverage.Close()
+	}
+
+	lintTestValues(chart, values, cfg)
+
+	// helm version is written in the snapshot header
+	helmVersion, err := charts.HelmVersion(cmd.Context(), o.HelmBin())
+	if err != nil {
+		log.Debug("failed to get helm version", "err", err)
+	}
+
+	eg, ctx := errgroup.WithContext(cmd.Context())
+	if !o.FailFast {
+		// not cancel ctx even if some case failed
+		ctx = cmd.Context()
+	}
+	// limit concurrency to o.Parallelism
+	eg.SetLimit(o.Parallelism)
+	if o.Debug() {
+		// limit concurrency to 1 for debugging.
+		eg.SetLimit(1)
+	}
+	for _, v := range values {
+		for _, m := range matrix[v] {
+			ht := charts.HelmTemplateCmdOptions{
+				HelmPath:       o.HelmBin(),
+				ReleaseName:    o.ReleaseName,
+				Namespace:      o.Namespace(),
+				Chart:          chart,
+				ValuesFile:     v,
+				KubeVersion:    m.KubeVersion,
+				APIVersions:    m.APIVersions,
+				AdditionalArgs: helmArgs,
+			}
+			testCase := fmt.Sprintf("chart=%s values=%s", o.Chart, ht.ValuesFile)
+			if m.ID() != "" {
+				testCase += fmt.Sprintf(" matrix=%s", m.ID())
+			}
+			bannerPrintln("RUNS", fmt.Sprintf("Snapshot testing %s", testCase), 0, color.BgBlue)
+			eg.Go(func() error {
+				snapshotter := newChartSnapshotter(ht, cfg, m, helmVersion)
+				snapshotter.Coverage = coverage
+				result, err := snapshotter.Snap(ctx)
+				if err != nil {
+					bannerPrintln("FAIL", fmt.Sprintf("%s err=%v snapshot_version=%s", testCase, err, snapshotter.SnapshotVersion), color.FgRed, color.BgRed)
+					return fmt.Errorf("failed to get snapshot %s: %w", testCase, err)
+				}
+				if !result.Match {
+					bannerPrintln("FAIL", fmt.Sprintf("Snapshot does not match %s snapshot_version=%s", testCase, snapshotter.SnapshotVersion), color.FgRed, color.BgRed)
+					fmt.Println(result.FailureMessage)
+					return fmt.Errorf("snapshot does not match %s", testCase)
+				}
+				bannerPrintln("PASS", fmt.Sprintf("Snapshot %s %s snapshot_version=%s", o.OK(), testCase, snapshotter.SnapshotVersion), color.FgGreen, color.BgGreen)
+				return nil
+			})
+		}
+	}
+
+	err = eg.Wait()
+	if err == nil {
+		bannerPrintln("PASS", fmt.Sprintf("All snapshots %s", o.OK()), color.FgGreen, color.BgGreen)
+	}
+
+	// coverage is reported even if some snapshots failed
+	if coverage != nil {
+		if coverageErr := reportTemplateCoverage(coverage.Report()); coverageErr != nil {
+			return errors.Join(err, coverageErr)
+		}
+	}
+	return err
+}
+
+// newChartSnapshotter returns the snapshotter of the test case with the snapshot file of the values file and the matrix entry.
+func newChartSnapshotter(ht charts.HelmTemplateCmdOptions, cfg v1alpha1.SnapshotConfig, m v1alpha1.MatrixEntry, helmVersion string) charts.ChartSnapshotter {
+	var snapshotFilePath string
+	if o.OutputDir != "" {
+		snapshotFilePath = charts.SnapshotFilePath(o.OutputDir, ht.ValuesFile)
+	} else {
+		snapshotFilePath = charts.DefaultSnapshotFilePath(o.Chart, ht.ValuesFile)
+	}
+	snapshotFilePath = charts.MatrixSnapshotFilePath(snapshotFilePath, m)
+
+	return charts.ChartSnapshotter{
+		HelmTemplateCmdOptions: ht,
+		SnapshotConfig:         cfg,
+		SnapshotFile:           snapshotFilePath,
+		SnapshotVersion:        o.snapshotVersion(),
+		DiffContextLineN:       o.DiffContextLineN,
+		UpdateSnapshot:         o.UpdateSnapshot,
+		HeaderVersion:          version,
+		FailHelmError:          o.FailHelmError,
+		HelmVersion:            helmVersion,
+		ChartVersionMismatch:   o.ChartVersionMismatch,
+		ValidateSchema:         o.ValidateSchema,
+		SchemaDirs:             o.SchemaDirs,
+		ValidateCRDs:           o.ValidateCRDs,
+		CRDDirs:                o.CRDDirs,
+		ValidateReferences:     o.ValidateReferences,
+		TargetKubeVersion:      o.TargetKubeVersion,
+		DeprecatedAPI:          o.DeprecatedAPI,
+		DuplicateResource:      o.DuplicateResource,
+	}
+}
+
+// reportTemplateCoverage prints or writes the template coverage report and checks --min-template-coverage.
+func reportTemplateCoverage(report *charts.TemplateCoverageReport) error {
+	format := o.TemplateCoverage
+	if format == "" {
+		format = charts.CoverageFormatText
+	}
+	out, err := report.Format(format)
+	if err != nil {
+		return err
+	}
+	if o.TemplateCoverageFile != "" {
+		if err := os.WriteFile(o.TemplateCoverageFile, []byte(out), 0644); err != nil {
+			return fmt.Errorf("failed to write template coverage report: %w", err)
+		}
+		log.Info("template coverage report written", "path", o.TemplateCoverageFile)
+	} else {
+		fmt.Print(out)
+	}
+
+	if report.Percentage < o.MinTemplateCoverage {
+		bannerPrintln("FAIL", fmt.Sprintf("Template coverage %.1f%% is below %.1f%%", report.Percentage, o.MinTemplateCoverage), color.FgRed, color.BgRed)
+		return fmt.Errorf("template coverage %.1f%% is below --min-template-coverage %.1f%%", report.Percentage, o.MinTemplateCoverage)
+	}
+	return nil
+}
+
+// runAgainstRef renders the chart and the test values at the git ref in a temporary worktree
+// and prints the diff with the working tree rendering for each test case.
+func runAgainstRef(ctx context.Context, cfg v1alpha1.SnapshotConfig, values []string, args []string) error {
+	if !charts.IsLocalChart(o.Chart) {
+		return fmt.Errorf("--against-ref is supported only for local charts")
+	}
+	w, err := charts.NewWorktree(ctx, o.Chart, o.AgainstRef)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := w.Remove(context.Background()); err != nil {
+			log.Warn("failed to clean up worktree", "dir", w.Dir, "err", err)
+		}
+	}()
+
+	refChart, ok := w.Path(o.Chart)
+	if !ok {
+		return fmt.Errorf("chart '%s' is not found at '%s'", o.Chart, o.AgainstRef)
+	}
+	if err := buildDependencies(ctx, refChart); err != nil {
+		return err
+	}
+
+	cases, err := compareTestCases(ctx, cfg, values, func(ht charts.HelmTemplateCmdOptions) (from, to charts.HelmTemplateCmdOptions) {
+		ht.AdditionalArgs = args
+		from, to = ht, ht
+		from.Chart, to.Chart = refChart, o.Chart
+		// new test values which do not exist at the ref are rendered as they are in the working tree
+		if v, ok := w.Path(ht.ValuesFile); ok && ht.ValuesFile != "" {
+			from.ValuesFile = v
+		}
+		return from, to
+	})
+	if err != nil {
+		return err
+	}
+	changed := printCompareCases(cases, o.AgainstRef, "working-tree")
+	bannerPrintln("DONE", fmt.Sprintf("%d of %d test cases rendered differently from %s", changed, len(cases), o.AgainstRef), 0, color.BgBlue)
+	return nil
+}
+
+// lintTestValues warns about the keys of the test values files which do not exist in the default values of the chart,
+// since misspelled keys are silently ignored by the chart.
+func lintTestValues(chart string, values []string, cfg v1alpha1.SnapshotConfig) {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		testSpec, err := charts.LoadTestSpec(v, cfg)
+		if err != nil {
+			// the error is reported when rendering the test case
+			continue
+		}
+		keys, err := charts.UnknownValuesKeys(chart, v, testSpec.AllowedValuesKeys)
+		if err != nil {
+			log.Debug("skipped linting values file", "values", v, "err", err)
+			continue
+		}
+		for _, k := range keys {
+			log.Warn("values key not found in the default values of the chart. add it to allowedValuesKeys if intended", "key", k, "values", v)
+		}
+	}
+}
+
+// loadTestValues returns the test values files of --values and loads the config file in the values directory.
+// If --values is not set, an empty values file is returned to test the default values.
+func loadTestValues(cfg *v1alpha1.SnapshotConfig) ([]string, error) {
 	values := []string{""}
 	if o.ValuesFile != "" {
 		stat, err := os.Stat(o.ValuesFile)
 		if err != nil {
 			if os.IsNotExist(err) {
-				return fmt.Errorf("values file '%s' not found", o.ValuesFile)
+				return nil, fmt.Errorf("values file '%s' not found", o.ValuesFile)
 			}
-			return fmt.Errorf("failed to stat values file %s: %w", o.ValuesFile, err)
+			return nil, fmt.Errorf("failed to stat values file %s: %w", o.ValuesFile, err)
 		}
 
 		if stat.IsDir() {
 			// get all values files in the directory
 			files, err := os.ReadDir(o.ValuesFile)
 			if err != nil {
-				return fmt.Errorf("failed to read values file directory: %w", err)
+				return nil, fmt.Errorf("failed to read values file directory: %w", err)
 			}
 			values = make([]string, 0)
 			for _, f := range files {
 				// pick config file in a test values directory
 				if f.Name() == o.ConfigFile {
-					if err = loadSnapshotConfig(path.Join(o.ValuesFile, f.Name()), &cfg); err != nil {
-						return err
+					if err = loadSnapshotConfig(path.Join(o.ValuesFile, f.Name()), cfg); err != nil {
+						return nil, err
 					}
 					continue
 				}
@@ -292,76 +638,71 @@ func run(cmd *cobra.Command, args []string) error {
 			// load .chartsnap config in the base directory if exist
 			dirCfg := path.Join(path.Dir(o.ValuesFile), o.ConfigFile)
 			if _, err := os.Stat(dirCfg); err == nil {
-				if err := loadSnapshotConfig(dirCfg, &cfg); err != nil {
-					return err
+				if err := loadSnapshotConfig(dirCfg, cfg); err != nil {
+					return nil, err
 				}
 			}
 		}
 	}
+	return values, nil
+}
 
-	eg, ctx := errgroup.WithContext(cmd.Context())
-	if !o.FailFast {
-		// not cancel ctx even if some case failed
-		ctx = cmd.Context()
-	}
-	// limit concurrency to o.Parallelism
-	eg.SetLimit(o.Parallelism)
-	if o.Debug() {
-		// limit concurrency to 1 for debugging.
-		eg.SetLimit(1)
-	}
+// testMatrix expands the test case for each Kubernetes version and API versions in the matrix of the test spec.
+// It returns the matrix entries of each values file, and an error if the entries of a values file cannot be distinguished.
+func testMatrix(values []string, cfg v1alpha1.SnapshotConfig) (map[string][]v1alpha1.MatrixEntry, error) {
+	matrix := make(map[string][]v1alpha1.MatrixEntry, len(values))
 	for _, v := range values {
-		ht := charts.HelmTemplateCmdOptions{
-			HelmPath:       o.HelmBin(),
-			ReleaseName:    o.ReleaseName,
-			Namespace:      o.Namespace(),
-			Chart:          o.Chart,
-			ValuesFile:     v,
-			AdditionalArgs: args,
+		testSpec, err := charts.LoadTestSpec(v, cfg)
+		if err != nil {
+			// the error is reported when rendering the test case
+			log.Debug("failed to load test spec for matrix", "values", v, "err", err)
+			matrix[v] = []v1alpha1.MatrixEntry{{}}
+			continue
 		}
-		bannerPrintln("RUNS",
-			fmt.Sprintf("Snapshot testing chart=%s values=%s", ht.Chart, ht.ValuesFile), 0, color.BgBlue)
-		eg.Go(func() error {
-			var snapshotFilePath string
-			if o.OutputDir != "" {
-				snapshotFilePath = charts.SnapshotFilePath(o.OutputDir, ht.ValuesFile)
-			} else {
-				snapshotFilePath = charts.DefaultSnapshotFilePath(ht.Chart, ht.ValuesFile)
-			}
-
-			snapshotter := charts.ChartSnapshotter{
-				HelmTemplateCmdOptions: ht,
-				SnapshotConfig:         cfg,
-				SnapshotFile:           snapshotFilePath,
-				SnapshotVersion:        o.snapshotVersion(),
-				DiffContextLineN:       o.DiffContextLineN,
-				UpdateSnapshot:         o.UpdateSnapshot,
-				HeaderVersion:          version,
-				FailHelmError:          o.FailHelmError,
-			}
-			result, err := snapshotter.Snap(ctx)
-			if err != nil {
-				bannerPrintln("FAIL", fmt.Sprintf("chart=%s values=%s err=%v snapshot_version=%s", ht.Chart, ht.ValuesFile, snapshotter.SnapshotVersion, err), color.FgRed, color.BgRed)
-				return fmt.Errorf("failed to get snapshot chart=%s values=%s: %w", ht.Chart, ht.ValuesFile, err)
-			}
-			if !result.Match {
-				bannerPrintln("FAIL", fmt.Sprintf("Snapshot does not match chart=%s values=%s snapshot_version=%s", ht.Chart, ht.ValuesFile, snapshotter.SnapshotVersion), color.FgRed, color.BgRed)
-				fmt.Println(result.FailureMessage)
-				return fmt.Errorf("snapshot does not match chart=%s values=%s", ht.Chart, ht.ValuesFile)
-			}
-			bannerPrintln("PASS", fmt.Sprintf("Snapshot %s chart=%s values=%s snapshot_version=%s", o.OK(), ht.Chart, ht.ValuesFile, snapshotter.SnapshotVersion), color.FgGreen, color.BgGreen)
-			return nil
-		})
+		if err := testSpec.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid matrix of values file '%s': %w", v, err)
+		}
+		if len(testSpec.Matrix) == 0 {
+			matrix[v] = []v1alpha1.MatrixEntry{{}}
+			continue
+		}
+		matrix[v] = testSpec.Matrix
 	}
+	return matrix, nil
+}
 
-	if err := eg.Wait(); err != nil {
-		return err
+// buildDependencies runs 'helm dependency build' if the dependencies of the local chart are stale.
+func buildDependencies(ctx context.Context, chart string) error {
+	if o.SkipDepBuild || !charts.IsLocalChart(chart) {
+		return nil
+	}
+	if dependencyBuilder == nil {
+		dependencyBuilder = &charts.DependencyBuilder{HelmPath: o.HelmBin(), CacheDir: o.cacheDir()}
+	}
+	// refreshed dependencies are reported in the logs
+	if _, err := dependencyBuilder.Build(ctx, chart); err != nil {
+		return fmt.Errorf("failed to build chart dependencies: %w", err)
 	}
-	bannerPrintln("PASS", fmt.Sprintf("All snapshots %s", o.OK()), color.FgGreen, color.BgGreen)
-
 	return nil
 }
 
+// fetchChart fetches the remote chart into the cache and returns the path of the archive and the rest of helm args.
+// If the chart is not remote, the chart and args are returned as they are.
+func fetchChart(ctx context.Context, chart string, args []string) (string, []string, error) {
+	remote, rest := charts.ParseRemoteChart(chart, args)
+	if remote == nil {
+		return chart, args, nil
+	}
+	if chartFetcher == nil {
+		chartFetcher = &charts.ChartFetcher{HelmPath: o.HelmBin(), CacheDir: o.cacheDir(), Offline: o.Offline}
+	}
+	archive, err := chartFetcher.Fetch(ctx, remote)
+	if err != nil {
+		return "", nil, err
+	}
+	return archive, rest, nil
+}
+
 func bannerPrintln(banner string, message string, fgColor color.Attribute, bgColor color.Attribute) {
 	mutex.Lock()
 	defer mutex.Unlock()
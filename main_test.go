@@ -2,7 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"os"
+	"os/exec"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/fatih/color"
@@ -171,6 +175,21 @@ var _ = Describe("rootCmd", func() {
 			})
 		})
 
+		Context("expected helm error with --fail-helm-error", func() {
+			It("should pass and snapshot the error", func() {
+				GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_error.bash")
+				outputDir := GinkgoT().TempDir()
+				rootCmd.SetArgs([]string{"--chart", "example/app3", "--namespace", "default", "-f", "example/app3/test/expect_error.yaml", "--fail-helm-error", "-o", outputDir})
+				err := rootCmd.Execute()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				b, err := os.ReadFile(path.Join(outputDir, "__snapshots__", "expect_error.snap"))
+				Expect(err).ShouldNot(HaveOccurred())
+				Ω(string(b)).To(ContainSubstring("kind: HelmError"))
+				Ω(string(b)).To(ContainSubstring("message: apiKey is required"))
+			})
+		})
+
 		Context("required flag is not set", func() {
 			It("should fail", func() {
 				rootCmd.SetArgs([]string{})
@@ -180,6 +199,39 @@ var _ = Describe("rootCmd", func() {
 			})
 		})
 
+		Context("invalid --deprecated-api", func() {
+			It("should fail", func() {
+				rootCmd.SetArgs([]string{"--chart", "example/app1", "-f", "example/app1/test_latest/test_ingress_enabled.yaml", "--target-kube-version", "1.29", "--deprecated-api", "ignore"})
+				err := rootCmd.Execute()
+				Expect(err).To(HaveOccurred())
+				Ω(err.Error()).To(MatchSnapShot())
+			})
+		})
+
+		Context("duplicate matrix ids", func() {
+			It("should fail", func() {
+				values := path.Join(GinkgoT().TempDir(), "matrix.yaml")
+				Expect(os.WriteFile(values, []byte(`testSpec:
+  matrix:
+    - kubeVersion: "1.29"
+    - kubeVersion: "v1.29"
+`), 0644)).To(Succeed())
+				rootCmd.SetArgs([]string{"--chart", "example/app1", "-f", values})
+				err := rootCmd.Execute()
+				Expect(err).To(HaveOccurred())
+				Ω(err.Error()).To(HaveSuffix("matrix entries #0 and #1 have the same id 'k8s-1.29'. set a unique name to each entry"))
+			})
+		})
+
+		Context("invalid --duplicate-resource", func() {
+			It("should fail", func() {
+				rootCmd.SetArgs([]string{"--chart", "example/app1", "-f", "example/app1/test_latest/test_ingress_enabled.yaml", "--duplicate-resource", "ignore"})
+				err := rootCmd.Execute()
+				Expect(err).To(HaveOccurred())
+				Ω(err.Error()).To(MatchSnapShot())
+			})
+		})
+
 		Context("invalid flag", func() {
 			It("should fail", func() {
 				rootCmd.SetArgs([]string{"--chart", "example/app1", "-f", "example/app1/test_latest/test_ingress_enabled.yaml", "--namespace", "default", "--invalid"})
@@ -190,6 +242,489 @@ var _ = Describe("rootCmd", func() {
 		})
 	})
 
+	Context("snap", func() {
+		manifests := `apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secret
+data:
+  token: cmFuZG9t
+`
+		It("should take a snapshot of stdin and match it", func() {
+			dir := GinkgoT().TempDir()
+			rootCmd.SetIn(bytes.NewBufferString(manifests))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(path.Join(dir, "__snapshots__", "stdin.snap")).To(BeARegularFile())
+
+			initRootCmd()
+			rootCmd.SetIn(bytes.NewBufferString(manifests))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir})
+			err = rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			initRootCmd()
+			rootCmd.SetIn(bytes.NewBufferString(strings.ReplaceAll(manifests, "app-secret", "changed")))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir})
+			err = rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+
+		It("should validate the schema of stdin", func() {
+			dir := GinkgoT().TempDir()
+			rootCmd.SetIn(bytes.NewBufferString(strings.ReplaceAll(manifests, "data:", "unknownField: foo\ndata:")))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir, "--validate-schema"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Expect(path.Join(dir, "__snapshots__", "stdin.snap")).NotTo(BeAnExistingFile())
+		})
+
+		It("should validate the references of stdin", func() {
+			dir := GinkgoT().TempDir()
+			rootCmd.SetIn(bytes.NewBufferString(`apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+`))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir, "--validate-references"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Expect(path.Join(dir, "__snapshots__", "stdin.snap")).NotTo(BeAnExistingFile())
+		})
+
+		It("should fail with duplicate resources of stdin if the action is fail", func() {
+			dir := GinkgoT().TempDir()
+			rootCmd.SetIn(bytes.NewBufferString(manifests + "---\n" + manifests))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "-o", dir, "--duplicate-resource", "fail"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Expect(path.Join(dir, "__snapshots__", "stdin.snap")).NotTo(BeAnExistingFile())
+		})
+
+		It("should fail with invalid --duplicate-resource", func() {
+			rootCmd.SetIn(bytes.NewBufferString(manifests))
+			rootCmd.SetArgs([]string{"snap", "--stdin", "--name", "stdin", "--duplicate-resource", "bogus"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+
+		It("should fail without input", func() {
+			rootCmd.SetArgs([]string{"snap", "--name", "stdin"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("render", func() {
+		It("should print normalized manifests of stdin", func() {
+			dir := GinkgoT().TempDir()
+			cfg := path.Join(dir, ".chartsnap.yaml")
+			Expect(os.WriteFile(cfg, []byte(`dynamicFields:
+  - apiVersion: v1
+    kind: Secret
+    name: app-secret
+    jsonPath:
+      - /data/token
+    base64: true
+`), 0644)).To(Succeed())
+
+			var output bytes.Buffer
+			rootCmd.SetOut(&output)
+			rootCmd.SetIn(bytes.NewBufferString(`apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secret
+data:
+  token: cmFuZG9t
+`))
+			rootCmd.SetArgs([]string{"render", "--stdin", "--config-file", cfg})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+			Ω(output.String()).To(MatchSnapShot())
+		})
+
+		It("should write the logs to stderr not to mix them with the manifests", func() {
+			// --debug is overridden by HELM_DEBUG
+			GinkgoT().Setenv("HELM_DEBUG", "")
+			var output, stderr bytes.Buffer
+			rootCmd.SetOut(&output)
+			rootCmd.SetErr(&stderr)
+			rootCmd.SetIn(bytes.NewBufferString("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n"))
+			rootCmd.SetArgs([]string{"render", "--stdin", "--debug"})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(output.String()).To(Equal("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n"))
+			Expect(stderr.String()).To(ContainSubstring("options"))
+		})
+
+		It("should fail with both chart and stdin", func() {
+			rootCmd.SetArgs([]string{"render", "--stdin", "-c", "example/app1"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("migrate", func() {
+		copySnapshot := func(src, dir string) string {
+			b, err := os.ReadFile(src)
+			Expect(err).ShouldNot(HaveOccurred())
+			dst := path.Join(dir, "__snapshots__", path.Base(src))
+			Expect(os.MkdirAll(path.Dir(dst), 0755)).To(Succeed())
+			Expect(os.WriteFile(dst, b, 0644)).To(Succeed())
+			return dst
+		}
+
+		It("should migrate v1 and v2 snapshots to v3", func() {
+			v1 := copySnapshot("example/app1/test_v1/__snapshots__/test_hpa_enabled.snap", path.Join(GinkgoT().TempDir(), "v1"))
+			v2 := copySnapshot("example/app1/test_v2/__snapshots__/test_hpa_enabled.snap", path.Join(GinkgoT().TempDir(), "v2"))
+
+			rootCmd.SetArgs([]string{"migrate", "--to", "v3", path.Dir(path.Dir(v1)), v2})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			for _, f := range []string{v1, v2} {
+				b, err := os.ReadFile(f)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(string(b)).To(HavePrefix("# chartsnap: snapshot_version=v3 "))
+			}
+		})
+
+		It("should not write snapshots with --dry-run", func() {
+			v2 := copySnapshot("example/app1/test_v2/__snapshots__/test_hpa_enabled.snap", GinkgoT().TempDir())
+			before, err := os.ReadFile(v2)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			rootCmd.SetArgs([]string{"migrate", "--dry-run", v2})
+			err = rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(os.ReadFile(v2)).To(Equal(before))
+		})
+
+		It("should fail with unsupported version", func() {
+			rootCmd.SetArgs([]string{"migrate", "--to", "v2", "."})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("--against-ref", func() {
+		var repo string
+		gitRun := func(args ...string) string {
+			cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+			cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+			out, err := cmd.CombinedOutput()
+			Expect(err).ShouldNot(HaveOccurred(), string(out))
+			return string(out)
+		}
+
+		BeforeEach(func() {
+			// fake helm prints the manifest file in the chart directory
+			dir := GinkgoT().TempDir()
+			helm := path.Join(dir, "helm")
+			Expect(os.WriteFile(helm, []byte("#!/bin/bash\n[ \"$1\" = template ] && cat \"$3/manifest.yaml\"\n"), 0755)).To(Succeed())
+			GinkgoT().Setenv("HELM_BIN", helm)
+
+			repo = GinkgoT().TempDir()
+			Expect(os.MkdirAll(path.Join(repo, "app1", "tests"), 0755)).To(Succeed())
+			Expect(os.WriteFile(path.Join(repo, "app1", "Chart.yaml"), []byte("name: app1\nversion: 0.1.0\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(path.Join(repo, "app1", "manifest.yaml"), []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app1\ndata:\n  key: before\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(path.Join(repo, "app1", "tests", "test_default.yaml"), []byte("{}\n"), 0644)).To(Succeed())
+			gitRun("init", "--quiet", "--initial-branch=main")
+			gitRun("add", "-A")
+			gitRun("commit", "--quiet", "-m", "init")
+
+			Expect(os.WriteFile(path.Join(repo, "app1", "manifest.yaml"), []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app1\ndata:\n  key: after\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(path.Join(repo, "app1", "tests", "test_new.yaml"), []byte("{}\n"), 0644)).To(Succeed())
+		})
+
+		It("should diff with the ref without snapshots", func() {
+			rootCmd.SetArgs([]string{"-c", path.Join(repo, "app1"), "-f", path.Join(repo, "app1", "tests"), "--against-ref", "main"})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(path.Join(repo, "app1", "tests", "__snapshots__")).NotTo(BeADirectory())
+			Expect(strings.Count(gitRun("worktree", "list"), "\n")).To(Equal(1))
+		})
+
+		It("should fail if the ref is not found", func() {
+			rootCmd.SetArgs([]string{"-c", path.Join(repo, "app1"), "--against-ref", "not-found"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to check out 'not-found'"))
+		})
+
+		It("should fail with the template coverage flags", func() {
+			rootCmd.SetArgs([]string{"-c", path.Join(repo, "app1"), "--against-ref", "main", "--min-template-coverage", "80"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("cannot be used with --against-ref"))
+			Expect(strings.Count(gitRun("worktree", "list"), "\n")).To(Equal(1))
+		})
+	})
+
+	Context("compare", func() {
+		var repo string
+		BeforeEach(func() {
+			// fake helm pulls an empty archive and renders a ConfigMap with the version in the chart archive name
+			dir := GinkgoT().TempDir()
+			helm := path.Join(dir, "helm")
+			Expect(os.WriteFile(helm, []byte(`#!/bin/bash
+if [ "$1" = "pull" ]; then
+  while [ $# -gt 0 ]; do
+    case "$1" in
+      --destination) dest="$2"; shift ;;
+      --version) version="$2"; shift ;;
+    esac
+    shift
+  done
+  touch "$dest/app1-$version.tgz"
+  exit 0
+fi
+if [ "$1" != "template" ]; then exit 1; fi
+version=$(basename "$3" .tgz); version=${version#app1-}
+cat <<EOT
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app1
+data:
+  version: "${version%%.*}"
+  image: "app1:$version"
+EOT
+`), 0755)).To(Succeed())
+			GinkgoT().Setenv("HELM_BIN", helm)
+			repo = "https://charts.example.com"
+		})
+
+		It("should print the diff and write the report", func() {
+			report := path.Join(GinkgoT().TempDir(), "report.md")
+			rootCmd.SetArgs([]string{"compare", "-c", "app1", "--from-version", "1.2.0", "--to-version", "1.3.0",
+				"-f", "example/app1/test_latest", "--cache-dir", GinkgoT().TempDir(), "--report", report, "--", "--repo", repo})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			b, err := os.ReadFile(report)
+			Expect(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).To(MatchSnapShot())
+		})
+
+		It("should fail with local chart", func() {
+			rootCmd.SetArgs([]string{"compare", "-c", "example/app1", "--from-version", "1.2.0", "--to-version", "1.3.0"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+
+		It("should fail with --version", func() {
+			rootCmd.SetArgs([]string{"compare", "-c", "app1", "--from-version", "1.2.0", "--to-version", "1.3.0", "--", "--repo", repo, "--version", "1.2.0"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("--template-coverage", func() {
+		var outputDir string
+		BeforeEach(func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_stub.bash")
+			outputDir = GinkgoT().TempDir()
+		})
+
+		It("should write the report", func() {
+			report := path.Join(GinkgoT().TempDir(), "coverage.json")
+			rootCmd.SetArgs([]string{"-c", "example/app1", "-f", "example/app1/test_latest", "-o", outputDir,
+				"--template-coverage", "json", "--template-coverage-file", report})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			b, err := os.ReadFile(report)
+			Expect(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).To(MatchSnapShot())
+		})
+
+		It("should write the report even if the snapshots fail", func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_error.bash")
+			report := path.Join(GinkgoT().TempDir(), "coverage.txt")
+			rootCmd.SetArgs([]string{"-c", "example/app1", "-o", outputDir, "--fail-helm-error",
+				"--template-coverage", "text", "--template-coverage-file", report, "--min-template-coverage", "80"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(ContainSubstring("failed to get snapshot"))
+			Ω(err.Error()).To(ContainSubstring("template coverage 0.0% is below --min-template-coverage 80.0%"))
+			Expect(report).To(BeAnExistingFile())
+		})
+
+		It("should fail if the coverage is below --min-template-coverage", func() {
+			rootCmd.SetArgs([]string{"-c", "example/app1", "-o", outputDir, "--min-template-coverage", "80"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+
+		It("should fail with invalid format", func() {
+			rootCmd.SetArgs([]string{"-c", "example/app1", "-o", outputDir, "--template-coverage", "xml"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("analyze-values", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_analyze.bash")
+		})
+
+		It("should analyze the values keys", func() {
+			rootCmd.SetArgs([]string{"analyze-values", "-c", "pkg/charts/testdata/analyze", "-f", "pkg/charts/testdata/analyze/tests", "--format", "json"})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail with invalid format", func() {
+			rootCmd.SetArgs([]string{"analyze-values", "-c", "pkg/charts/testdata/analyze", "--format", "xml"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("scaffold", func() {
+		var outputDir string
+		BeforeEach(func() {
+			dir := GinkgoT().TempDir()
+			helm := path.Join(dir, "helm")
+			Expect(os.WriteFile(helm, []byte(`#!/bin/bash
+[ "$1" = template ] || exit 0
+cat <<EOT
+---
+# Source: app1/templates/cert.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app1-cert
+data:
+  tls.crt: $(echo $RANDOM$RANDOM | base64)
+EOT
+`), 0755)).To(Succeed())
+			GinkgoT().Setenv("HELM_BIN", helm)
+			outputDir = path.Join(GinkgoT().TempDir(), "tests")
+		})
+
+		It("should generate test values files, the config file and snapshots", func() {
+			rootCmd.SetArgs([]string{"scaffold", "-c", "example/app1", "-o", outputDir})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(path.Join(outputDir, "test_ingress_enabled.yaml")).To(BeARegularFile())
+			Expect(path.Join(outputDir, "test_all_enabled.yaml")).To(BeARegularFile())
+			Expect(path.Join(outputDir, "__snapshots__", "test_all_enabled.snap")).To(BeARegularFile())
+			b, err := os.ReadFile(path.Join(outputDir, ".chartsnap.yaml"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).To(MatchSnapShot())
+
+			// existing files are not overwritten and the snapshots match
+			Expect(os.WriteFile(path.Join(outputDir, "test_ingress_enabled.yaml"), []byte("ingress:\n  enabled: true\n"), 0644)).To(Succeed())
+			initRootCmd()
+			rootCmd.SetArgs([]string{"scaffold", "-c", "example/app1", "-o", outputDir})
+			Expect(rootCmd.Execute()).To(Succeed())
+			Expect(os.ReadFile(path.Join(outputDir, "test_ingress_enabled.yaml"))).To(BeEquivalentTo("ingress:\n  enabled: true\n"))
+		})
+
+		It("should fail without --output-dir", func() {
+			rootCmd.SetArgs([]string{"scaffold", "-c", "example/app1"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("fuzz", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_fuzz.bash")
+		})
+
+		It("should save the failing inputs as test values files", func() {
+			outputDir := GinkgoT().TempDir()
+			rootCmd.SetArgs([]string{"fuzz", "-c", "pkg/charts/testdata/fuzz", "--iterations", "20", "--seed", "1", "-o", outputDir})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+
+			b, err := os.ReadFile(path.Join(outputDir, "test_fuzz_1_3.yaml"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Ω(string(b)).To(MatchSnapShot())
+		})
+
+		It("should fail with invalid iterations", func() {
+			rootCmd.SetArgs([]string{"fuzz", "-c", "pkg/charts/testdata/fuzz", "--iterations", "0"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("mutate", func() {
+		BeforeEach(func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_mutate.bash")
+		})
+
+		It("should report the survived mutants", func() {
+			outputDir := GinkgoT().TempDir()
+			rootCmd.SetArgs([]string{"-c", "pkg/charts/testdata/mutate", "-o", outputDir})
+			Expect(rootCmd.Execute()).To(Succeed())
+
+			initRootCmd()
+			rootCmd.SetArgs([]string{"mutate", "-c", "pkg/charts/testdata/mutate", "-o", outputDir, "--format", "json"})
+			err := rootCmd.Execute()
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("should fail without snapshots", func() {
+			rootCmd.SetArgs([]string{"mutate", "-c", "pkg/charts/testdata/mutate", "-o", GinkgoT().TempDir()})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+
+		It("should fail with remote chart", func() {
+			rootCmd.SetArgs([]string{"mutate", "-c", "oci://ghcr.io/jlandowner/charts/app1"})
+			err := rootCmd.Execute()
+			Expect(err).To(HaveOccurred())
+			Ω(err.Error()).To(MatchSnapShot())
+		})
+	})
+
+	Context("dependencies", func() {
+		It("should build the dependencies once per chart in a process", func() {
+			GinkgoT().Setenv("HELM_BIN", "pkg/charts/testdata/helm_dependency.bash")
+			chart := path.Join(GinkgoT().TempDir(), "umbrella")
+			Expect(os.MkdirAll(chart, 0755)).To(Succeed())
+			for _, f := range []string{"Chart.yaml", "Chart.lock"} {
+				b, err := os.ReadFile(path.Join("pkg/charts/testdata/umbrella", f))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(path.Join(chart, f), b, 0644)).To(Succeed())
+			}
+			o.CacheDir = GinkgoT().TempDir()
+
+			Expect(buildDependencies(context.Background(), chart)).To(Succeed())
+			Expect(os.Remove(path.Join(chart, "charts", "app1-0.1.0.tgz"))).To(Succeed())
+			// e.g. the dependencies are built by the command and a test case
+			Expect(buildDependencies(context.Background(), chart)).To(Succeed())
+
+			calls, err := os.ReadFile(path.Join(chart, "..", "helm_calls"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.Split(strings.TrimSpace(string(calls)), "\n")).To(HaveLen(1))
+		})
+	})
+
 	Context("--help", func() {
 		It("should show help", func() {
 			rootCmd.SetArgs([]string{"--help"})
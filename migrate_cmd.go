@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+	"github.com/jlandowner/helm-chartsnap/pkg/snap"
+)
+
+func newMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate --to v3 PATH...",
+		Short: "Convert snapshot files in old formats into the latest format",
+		Long: `
+Convert snapshot files in old formats into the latest format without rendering the chart again.
+
+v1 (toml multi-snapshot) and v2 (no header) snapshot files are re-encoded and the header is added.
+If PATH is a directory, all snapshot files in '__snapshots__' directories under it are converted.
+It reports the changed files and whether the manifests stayed semantically the same.
+
+The old formats have neither the '# Source:' comments nor the key order of the templates,
+so the migrated snapshots are written without comments and with the keys sorted, and marked by 'migrated_from' in the header.
+They are matched in the same form until you update them with --update-snapshot.
+`,
+		Example: `
+  # Migrate all snapshot files in the test values directory:
+  chartsnap migrate --to v3 YOUR_TEST_VALUES_DIRECTORY
+
+  # Write the chart metadata in the header:
+  chartsnap migrate --to v3 -c YOUR_CHART_DIRECTORY YOUR_TEST_VALUES_DIRECTORY
+
+  # Show the files to be migrated without writing them:
+  chartsnap migrate --to v3 --dry-run .`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runMigrate,
+	}
+	cmd.Flags().StringVar(&o.MigrateTo, "to", charts.SnapshotVersionLatest, "snapshot format version to migrate to. only v3 is supported")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "report the files to be migrated without writing them")
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory to write its metadata in the header")
+	if err := cmd.MarkFlagDirname("chart"); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// snapshotFiles returns the snapshot files in the path.
+// If the path is a directory, the snapshot files in '__snapshots__' directories under it are returned.
+func snapshotFiles(p string) ([]string, error) {
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return []string{p}, nil
+	}
+
+	files := make([]string, 0)
+	err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".snap") && filepath.Base(filepath.Dir(path)) == "__snapshots__" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	if o.MigrateTo != charts.SnapshotVersionV3 {
+		return fmt.Errorf("unsupported snapshot version '%s'. only %s is supported", o.MigrateTo, charts.SnapshotVersionV3)
+	}
+
+	files := make([]string, 0)
+	for _, p := range args {
+		f, err := snapshotFiles(p)
+		if err != nil {
+			return fmt.Errorf("failed to find snapshot files: %w", err)
+		}
+		files = append(files, f...)
+	}
+
+	// the header is the same as the one written by the snapshot of the chart
+	helmVersion, err := charts.HelmVersion(cmd.Context(), o.HelmBin())
+	if err != nil {
+		log.Debug("failed to get helm version", "err", err)
+	}
+	header := (&charts.ChartSnapshotter{
+		HelmTemplateCmdOptions: charts.HelmTemplateCmdOptions{Chart: o.Chart, ReleaseName: o.ReleaseName, Namespace: o.Namespace()},
+		SnapshotVersion:        o.MigrateTo,
+		HeaderVersion:          version,
+		HelmVersion:            helmVersion,
+	}).Header()
+
+	var migratedN, notEqualN int
+	for _, file := range files {
+		migrated, err := charts.MigrateSnapshot(file, o.MigrateTo, *header)
+		if err != nil {
+			log.Warn("skipped migration", "path", file, "err", err)
+			continue
+		}
+		if len(migrated) == 0 {
+			log.Debug("snapshot is already in the version", "path", file, "version", o.MigrateTo)
+			continue
+		}
+
+		keepSource := false
+		for _, m := range migrated {
+			keepSource = keepSource || m.Path == m.Source
+			if !m.Changed() {
+				continue
+			}
+			migratedN++
+			msg := fmt.Sprintf("%s from=%s to=%s semantically_equal=%t", m.Path, m.FromVersion, o.MigrateTo, m.SemanticallyEqual)
+			if m.Path != m.Source {
+				msg += fmt.Sprintf(" source=%s", m.Source)
+			}
+			if m.SemanticallyEqual {
+				bannerPrintln("MIGRATE", msg, color.FgGreen, color.BgGreen)
+			} else {
+				notEqualN++
+				bannerPrintln("MIGRATE", msg, color.FgYellow, color.BgYellow)
+			}
+
+			if o.DryRun {
+				continue
+			}
+			if err := snap.WriteFile(m.Path, m.Data); err != nil {
+				return fmt.Errorf("failed to write migrated snapshot: %w", err)
+			}
+		}
+
+		// v1 multi-snapshot file is removed if all of the snapshots are migrated into the other files
+		if !o.DryRun && !keepSource {
+			if err := snap.RemoveFile(file); err != nil {
+				return fmt.Errorf("failed to remove migrated snapshot: %w", err)
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("Migrated %d snapshots to %s", migratedN, o.MigrateTo)
+	if o.DryRun {
+		summary += " (dry run)"
+	}
+	if notEqualN > 0 {
+		bannerPrintln("WARN", fmt.Sprintf("%s. %d snapshots are not semantically equal to the sources. please review them", summary, notEqualN), color.FgYellow, color.BgYellow)
+		return nil
+	}
+	bannerPrintln("PASS", summary, color.FgGreen, color.BgGreen)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newMutateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mutate -c CHART",
+		Short: "Measure how effectively the snapshots detect changes of the chart templates",
+		Long: `
+Measure how effectively the snapshots detect changes of the chart templates.
+
+The chart is copied to a temporary directory and mutated one at a time:
+'if' conditions are negated, 'with' blocks are dropped, the literals of 'default' are changed and the templates are removed.
+The snapshot tests of all the test values files run for each mutant without updating the snapshots.
+The mutants which no test case detects are reported as survived. They are the parts of the chart effectively untested.
+The snapshots must be taken and match before mutation testing. Only local chart directories are supported.
+`,
+		Example: `
+  # Mutation testing with the default values:
+  chartsnap mutate -c YOUR_CHART
+
+  # Mutation testing with your test values:
+  chartsnap mutate -c YOUR_CHART -f YOUR_TEST_VALUES_FILES_DIRECTOY`,
+		RunE: runMutate,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory")
+	if err := cmd.MarkFlagRequired("chart"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().StringVar(&o.Format, "format", charts.CoverageFormatText, "output format of the report. text or json")
+	return cmd
+}
+
+func runMutate(cmd *cobra.Command, args []string) error {
+	switch o.Format {
+	case charts.CoverageFormatText, charts.CoverageFormatJSON:
+	default:
+		return fmt.Errorf("invalid --format '%s'. text or json is supported", o.Format)
+	}
+	if !charts.IsLocalChart(o.Chart) {
+		return fmt.Errorf("mutate is supported only for local charts")
+	}
+
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+	values, err := loadTestValues(&cfg)
+	if err != nil {
+		return err
+	}
+	matrix, err := testMatrix(values, cfg)
+	if err != nil {
+		return err
+	}
+	if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+		return err
+	}
+
+	// helm version is compared with the snapshot header
+	helmVersion, err := charts.HelmVersion(cmd.Context(), o.HelmBin())
+	if err != nil {
+		log.Debug("failed to get helm version", "err", err)
+	}
+
+	// the snapshots are never updated by the mutants
+	o.UpdateSnapshot = false
+	tester := &charts.MutationTester{Chart: o.Chart, Parallelism: o.Parallelism}
+	for _, v := range values {
+		for _, m := range matrix[v] {
+			ht := charts.HelmTemplateCmdOptions{
+				HelmPath:       o.HelmBin(),
+				ReleaseName:    o.ReleaseName,
+				Namespace:      o.Namespace(),
+				Chart:          o.Chart,
+				ValuesFile:     v,
+				KubeVersion:    m.KubeVersion,
+				APIVersions:    m.APIVersions,
+				AdditionalArgs: args,
+			}
+			tester.Snapshotters = append(tester.Snapshotters, newChartSnapshotter(ht, cfg, m, helmVersion))
+		}
+	}
+	if o.Debug() {
+		tester.Parallelism = 1
+	}
+
+	bannerPrintln("RUNS", fmt.Sprintf("Mutation testing chart=%s with %d test cases", o.Chart, len(tester.Snapshotters)), 0, color.BgBlue)
+	report, err := tester.Run(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	out, err := report.Format(o.Format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	bannerPrintln("DONE", fmt.Sprintf("%d of %d mutants survived. mutation score %.1f%%", report.Survived, report.Total, report.Score), 0, color.BgBlue)
+	return nil
+}
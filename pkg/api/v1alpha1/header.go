@@ -3,38 +3,114 @@ package v1alpha1
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
+const headerPrefix = "# chartsnap:"
+
+// Header is the metadata written on the first line of the snapshot file.
+// Only SnapshotVersion and MigratedFrom are used to match snapshots. The others are for reviewers to know how the snapshot was taken.
 type Header struct {
-	SnapshotVersion string `header:"snapshot_version"`
+	SnapshotVersion  string `header:"snapshot_version"`
+	Chart            string `header:"chart"`
+	ChartVersion     string `header:"chart_version"`
+	AppVersion       string `header:"app_version"`
+	HelmVersion      string `header:"helm_version"`
+	ChartsnapVersion string `header:"chartsnap_version"`
+	ReleaseName      string `header:"release_name"`
+	Namespace        string `header:"namespace"`
+	// MigratedFrom is the snapshot version of the source if the snapshot is converted by 'chartsnap migrate'.
+	// The migrated snapshot is matched in the migrated form until it is updated.
+	MigratedFrom string `header:"migrated_from"`
 }
 
 func (h *Header) ToString() string {
-	return fmt.Sprintf("# chartsnap: snapshot_version=%s\n---\n", h.SnapshotVersion)
+	ht := reflect.TypeOf(*h)
+	hv := reflect.ValueOf(*h)
+
+	items := make([]string, 0, hv.NumField())
+	for i := 0; i < hv.NumField(); i++ {
+		tag, ok := ht.Field(i).Tag.Lookup("header")
+		value := hv.Field(i).String()
+		if !ok || (value == "" && tag != "snapshot_version") {
+			continue
+		}
+		items = append(items, fmt.Sprintf("%s=%s", tag, quoteHeaderValue(value)))
+	}
+	return fmt.Sprintf("%s %s\n---\n", headerPrefix, strings.Join(items, " "))
+}
+
+func quoteHeaderValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " \t\"'=") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// IsHeader returns true if the line is a snapshot header.
+func IsHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), headerPrefix)
 }
 
+// ParseHeader parses the snapshot header line.
+// Values can be quoted by double quotes, and unknown keys are ignored for forward compatibility.
 func ParseHeader(line string) *Header {
 	h := Header{}
 	ht := reflect.TypeOf(h)
 	hv := reflect.ValueOf(&h).Elem()
 
-	split := strings.Split(string([]byte(line)[1:]), " ")
-	for _, v := range split {
-		s := strings.Split(v, "=")
-		if len(s) != 2 {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, headerPrefix)
+	line = strings.TrimPrefix(line, "#")
+
+	for _, item := range splitHeaderItems(line) {
+		headerName, headerValue, ok := strings.Cut(item, "=")
+		if !ok {
 			continue
 		}
-
-		headerName := strings.TrimSpace(s[0])
-		headerValue := strings.TrimSpace(s[1])
+		headerName = strings.TrimSpace(headerName)
+		headerValue = strings.TrimSpace(headerValue)
+		if unquoted, err := strconv.Unquote(headerValue); err == nil {
+			headerValue = unquoted
+		}
 
 		for i := 0; i < hv.NumField(); i++ {
-			field := ht.Field(i)
-			if tag, ok := field.Tag.Lookup("header"); ok && tag == headerName {
+			if tag, ok := ht.Field(i).Tag.Lookup("header"); ok && tag == headerName {
 				hv.Field(i).SetString(headerValue)
 			}
 		}
 	}
 	return &h
 }
+
+// splitHeaderItems splits the line by whitespaces except in double quotes.
+func splitHeaderItems(line string) []string {
+	items := make([]string, 0)
+	var (
+		item    strings.Builder
+		quoted  bool
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t'):
+			if item.Len() > 0 {
+				items = append(items, item.String())
+				item.Reset()
+			}
+			continue
+		}
+		item.WriteRune(r)
+	}
+	if item.Len() > 0 {
+		items = append(items, item.String())
+	}
+	return items
+}
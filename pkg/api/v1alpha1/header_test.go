@@ -11,6 +11,11 @@ func TestHeader_ToString(t *testing.T) {
 		SnapshotVersion string
 		Chart           string
 		Values          string
+		ChartVersion    string
+		AppVersion      string
+		HelmVersion     string
+		ReleaseName     string
+		Namespace       string
 	}
 	tests := []struct {
 		name   string
@@ -24,11 +29,41 @@ func TestHeader_ToString(t *testing.T) {
 			},
 			want: "# chartsnap: snapshot_version=v3\n---\n",
 		},
+		{
+			name: "Test Header ToString with metadata",
+			fields: fields{
+				SnapshotVersion: "v3",
+				Chart:           "app1",
+				ChartVersion:    "0.1.0",
+				AppVersion:      "1.16.0",
+				HelmVersion:     "v3.15.4",
+				Version:         "v0.5.0",
+				ReleaseName:     "chartsnap",
+				Namespace:       "default",
+			},
+			want: "# chartsnap: snapshot_version=v3 chart=app1 chart_version=0.1.0 app_version=1.16.0 helm_version=v3.15.4 chartsnap_version=v0.5.0 release_name=chartsnap namespace=default\n---\n",
+		},
+		{
+			name: "Test Header ToString with quoted values",
+			fields: fields{
+				SnapshotVersion: "v3",
+				Chart:           "my chart",
+				AppVersion:      `1.0 "beta"`,
+			},
+			want: "# chartsnap: snapshot_version=v3 chart=\"my chart\" app_version=\"1.0 \\\"beta\\\"\"\n---\n",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &Header{
-				SnapshotVersion: tt.fields.SnapshotVersion,
+				SnapshotVersion:  tt.fields.SnapshotVersion,
+				Chart:            tt.fields.Chart,
+				ChartVersion:     tt.fields.ChartVersion,
+				AppVersion:       tt.fields.AppVersion,
+				HelmVersion:      tt.fields.HelmVersion,
+				ChartsnapVersion: tt.fields.Version,
+				ReleaseName:      tt.fields.ReleaseName,
+				Namespace:        tt.fields.Namespace,
 			}
 			if got := h.ToString(); got != tt.want {
 				t.Errorf("Header.ToString() = %v, want %v", got, tt.want)
@@ -55,6 +90,47 @@ func TestParseHeader(t *testing.T) {
 				SnapshotVersion: "v3",
 			},
 		},
+		{
+			name: "Test ParseHeader with metadata",
+			args: args{
+				line: "# chartsnap: snapshot_version=v3 chart=app1 chart_version=0.1.0 app_version=1.16.0 helm_version=v3.15.4 chartsnap_version=v0.5.0 release_name=chartsnap namespace=default",
+			},
+			want: &Header{
+				SnapshotVersion:  "v3",
+				Chart:            "app1",
+				ChartVersion:     "0.1.0",
+				AppVersion:       "1.16.0",
+				HelmVersion:      "v3.15.4",
+				ChartsnapVersion: "v0.5.0",
+				ReleaseName:      "chartsnap",
+				Namespace:        "default",
+			},
+		},
+		{
+			name: "Test ParseHeader with quoted values and unknown keys",
+			args: args{
+				line: `# chartsnap: snapshot_version="v3"  chart="my chart" app_version="1.0 \"beta\"" unknown=xxx novalue`,
+			},
+			want: &Header{
+				SnapshotVersion: "v3",
+				Chart:           "my chart",
+				AppVersion:      `1.0 "beta"`,
+			},
+		},
+		{
+			name: "Test ParseHeader not header",
+			args: args{
+				line: "# Source: app1/templates/service.yaml",
+			},
+			want: &Header{},
+		},
+		{
+			name: "Test ParseHeader empty",
+			args: args{
+				line: "",
+			},
+			want: &Header{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+// HelmError is the error of 'helm template' parsed from its error output.
+// It is snapshotted instead of the raw error output, so that the snapshots of error cases do not churn on the formatting.
+type HelmError struct {
+	// Template is the path of the template in the chart. e.g. app1/templates/secret.yaml
+	Template string
+	// Line and Column are the position of the failed action in the template. 0 if unknown.
+	Line   int
+	Column int
+	// Function is the template function which failed. e.g. tpl
+	Function string
+	// Message is the error message without the position.
+	Message string
+}
+
+// Error returns the message with the position of the template. e.g. app1/templates/secret.yaml:8:13: apiKey is required
+func (e *HelmError) Error() string {
+	msg := e.Message
+	if e.Function != "" {
+		msg = fmt.Sprintf("error calling %s: %s", e.Function, msg)
+	}
+	if loc := e.Location(); loc != "" {
+		return loc + ": " + msg
+	}
+	return msg
+}
+
+// Location returns the position of the template. e.g. app1/templates/secret.yaml:8:13
+func (e *HelmError) Location() string {
+	loc := e.Template
+	if loc != "" && e.Line > 0 {
+		loc += ":" + strconv.Itoa(e.Line)
+		if e.Column > 0 {
+			loc += ":" + strconv.Itoa(e.Column)
+		}
+	}
+	return loc
+}
+
+func (e *HelmError) Node() *yaml.Node {
+	n := &yaml.Node{
+		Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "apiVersion"},
+			{Kind: yaml.ScalarNode, Value: GroupVersion.String()},
+			{Kind: yaml.ScalarNode, Value: "kind"},
+			{Kind: yaml.ScalarNode, Value: "HelmError"},
+		},
+	}
+	add := func(key, value, tag string) {
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &yaml.Node{Kind: yaml.ScalarNode, Value: value, Tag: tag})
+	}
+	if e.Template != "" {
+		add("template", e.Template, "!!str")
+	}
+	if e.Line > 0 {
+		add("line", strconv.Itoa(e.Line), "!!int")
+	}
+	if e.Column > 0 {
+		add("column", strconv.Itoa(e.Column), "!!int")
+	}
+	if e.Function != "" {
+		add("function", e.Function, "!!str")
+	}
+	add("message", e.Message, "!!str")
+	return n
+}
@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"testing"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func TestHelmError_Node(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *HelmError
+		want string
+	}{
+		{
+			name: "full",
+			err:  &HelmError{Template: "app1/templates/configmap.yaml", Line: 6, Column: 10, Function: "tpl", Message: "error"},
+			want: `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: HelmError
+template: app1/templates/configmap.yaml
+line: 6
+column: 10
+function: tpl
+message: error
+`,
+		},
+		{
+			name: "without position",
+			err:  &HelmError{Template: "app1/templates/service.yaml", Message: "yaml: line 5: did not find expected key"},
+			want: `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: HelmError
+template: app1/templates/service.yaml
+message: 'yaml: line 5: did not find expected key'
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(tt.err.Node()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("HelmError.Node() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelmError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *HelmError
+		want string
+	}{
+		{name: "full", err: &HelmError{Template: "app1/templates/configmap.yaml", Line: 6, Column: 10, Function: "tpl", Message: "error"}, want: "app1/templates/configmap.yaml:6:10: error calling tpl: error"},
+		{name: "line only", err: &HelmError{Template: "app1/templates/service.yaml", Line: 5, Message: "error"}, want: "app1/templates/service.yaml:5: error"},
+		{name: "template only", err: &HelmError{Template: "app1/templates/service.yaml", Message: "error"}, want: "app1/templates/service.yaml: error"},
+		{name: "message only", err: &HelmError{Message: "error"}, want: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("HelmError.Error() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
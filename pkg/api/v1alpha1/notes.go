@@ -0,0 +1,28 @@
+package v1alpha1
+
+import (
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func NewNotes(raw string) *Notes {
+	return &Notes{Raw: raw}
+}
+
+// Notes is the rendered NOTES.txt of the chart.
+// It is snapshotted as a dedicated document because 'helm template' does not render it.
+type Notes struct {
+	Raw string
+}
+
+func (e *Notes) Node() *yaml.Node {
+	return &yaml.Node{
+		Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "apiVersion"},
+			{Kind: yaml.ScalarNode, Value: GroupVersion.String()},
+			{Kind: yaml.ScalarNode, Value: "kind"},
+			{Kind: yaml.ScalarNode, Value: "Notes"},
+			{Kind: yaml.ScalarNode, Value: "raw"},
+			{Kind: yaml.ScalarNode, Value: e.Raw, Style: yaml.LiteralStyle},
+		},
+	}
+}
@@ -0,0 +1,27 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"testing"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func TestNotes_Node(t *testing.T) {
+	notes := NewNotes("1. Get the application URL by running these commands:\n  http://chart-example.local/\n")
+	want := `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: Notes
+raw: |
+  1. Get the application URL by running these commands:
+    http://chart-example.local/
+`
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(notes.Node()); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("Notes.Node() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,33 @@
+package v1alpha1
+
+import (
+	"strconv"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func NewStderr(raw string, exitCode int) *Stderr {
+	return &Stderr{Raw: raw, ExitCode: exitCode}
+}
+
+// Stderr is the stderr output and the exit code of the render command like 'helm template'.
+// It is snapshotted as a dedicated document separated from the manifests.
+type Stderr struct {
+	Raw      string
+	ExitCode int
+}
+
+func (e *Stderr) Node() *yaml.Node {
+	return &yaml.Node{
+		Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "apiVersion"},
+			{Kind: yaml.ScalarNode, Value: GroupVersion.String()},
+			{Kind: yaml.ScalarNode, Value: "kind"},
+			{Kind: yaml.ScalarNode, Value: "Stderr"},
+			{Kind: yaml.ScalarNode, Value: "exitCode"},
+			{Kind: yaml.ScalarNode, Value: strconv.Itoa(e.ExitCode), Tag: "!!int"},
+			{Kind: yaml.ScalarNode, Value: "raw"},
+			{Kind: yaml.ScalarNode, Value: e.Raw, Style: yaml.LiteralStyle},
+		},
+	}
+}
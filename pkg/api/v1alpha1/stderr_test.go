@@ -0,0 +1,50 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"testing"
+
+	yaml "sigs.k8s.io/yaml/goyaml.v3"
+)
+
+func TestStderr_Node(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr *Stderr
+		want   string
+	}{
+		{
+			name:   "warning",
+			stderr: NewStderr("walk.go:74: found symbolic link in path\n", 0),
+			want: `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: Stderr
+exitCode: 0
+raw: |
+  walk.go:74: found symbolic link in path
+`,
+		},
+		{
+			name:   "error",
+			stderr: NewStderr("Error: execution error", 1),
+			want: `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: Stderr
+exitCode: 1
+raw: |-
+  Error: execution error
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(tt.stderr.Node()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Stderr.Node() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
 
 	yaml "sigs.k8s.io/yaml/goyaml.v3"
 )
@@ -27,7 +28,34 @@ type SnapshotValues struct {
 }
 
 type SnapshotConfig struct {
-	DynamicFields []ManifestPath `yaml:"dynamicFields,omitempty"`
+	DynamicFields []ManifestPath  `yaml:"dynamicFields,omitempty"`
+	Matrix        []MatrixEntry   `yaml:"matrix,omitempty"`
+	Renderer      *RendererConfig `yaml:"renderer,omitempty"`
+	// SnapshotStderr stores the stderr output and the exit code of the render command in a dedicated document of the snapshot.
+	SnapshotStderr bool `yaml:"snapshotStderr,omitempty"`
+	// IgnoreStderrPatterns is a list of regular expressions. The lines of stderr matching any of them are ignored.
+	IgnoreStderrPatterns []string `yaml:"ignoreStderrPatterns,omitempty"`
+	// RenderNotes renders NOTES.txt by 'helm install --dry-run=client' and stores it in a dedicated document of the snapshot.
+	RenderNotes bool `yaml:"renderNotes,omitempty"`
+	// GroupHooks moves hook resources to the end of the snapshot grouped by hook phases and sorted by hook weights.
+	GroupHooks bool `yaml:"groupHooks,omitempty"`
+	// ValidateSchema validates the rendered resources against the Kubernetes schemas and fails the test on violations.
+	ValidateSchema bool `yaml:"validateSchema,omitempty"`
+	// ValidateCRDs validates the custom resources against the schemas of the CustomResourceDefinitions and fails the test on violations.
+	ValidateCRDs bool `yaml:"validateCRDs,omitempty"`
+	// ValidateReferences checks the references between the rendered resources and fails the test on broken ones.
+	ValidateReferences bool `yaml:"validateReferences,omitempty"`
+	// ExternalReferences are the 'Kind/name' patterns of the referred resources which are provided outside of the chart.
+	// '*' matches any characters in a name. e.g. Secret/tls-*
+	ExternalReferences []string `yaml:"externalReferences,omitempty"`
+	// DeprecatedAPIs adds or overrides the entries of the built-in deprecated API table.
+	DeprecatedAPIs []DeprecatedAPI `yaml:"deprecatedAPIs,omitempty"`
+	// AllowedValuesKeys are the dot-separated keys of the test values which are not warned even if they are not in the chart's default values.
+	// '*' matches any key in a segment. e.g. extraEnv.*
+	AllowedValuesKeys []string `yaml:"allowedValuesKeys,omitempty"`
+	// ExpectError is the error message which the render command must fail with. It matches if the error of the command,
+	// stderr or stdout contains it or matches it as a regular expression. The error is snapshotted if it matches.
+	ExpectError string `yaml:"expectError,omitempty"`
 }
 
 type ManifestPath struct {
@@ -50,10 +78,95 @@ func (v *ManifestPath) DynamicValue() string {
 	}
 }
 
+// MatrixEntry is a combination of Kubernetes version and API versions.
+// Each test case is snapshotted once per entry with 'helm template --kube-version --api-versions'.
+type MatrixEntry struct {
+	Name        string   `yaml:"name,omitempty"`
+	KubeVersion string   `yaml:"kubeVersion,omitempty"`
+	APIVersions []string `yaml:"apiVersions,omitempty"`
+}
+
+// ID returns the identifier of the matrix entry which is used in the snapshot file name.
+// If name is not specified, it is generated from kubeVersion and apiVersions. e.g. k8s-1.25
+func (m *MatrixEntry) ID() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	ids := make([]string, 0, len(m.APIVersions)+1)
+	if m.KubeVersion != "" {
+		ids = append(ids, "k8s-"+strings.TrimPrefix(m.KubeVersion, "v"))
+	}
+	for _, v := range m.APIVersions {
+		ids = append(ids, strings.ReplaceAll(v, "/", "-"))
+	}
+	return strings.Join(ids, "+")
+}
+
+// Validate checks that the matrix entries have unique IDs since each entry is snapshotted into the file of its ID.
+func (t *SnapshotConfig) Validate() error {
+	ids := make(map[string]int, len(t.Matrix))
+	for i, m := range t.Matrix {
+		if j, ok := ids[m.ID()]; ok {
+			return fmt.Errorf("matrix entries #%d and #%d have the same id '%s'. set a unique name to each entry", j, i, m.ID())
+		}
+		ids[m.ID()] = i
+	}
+	return nil
+}
+
+// DeprecatedAPI is an entry of the deprecated API table used to check the rendered resources for a target Kubernetes version.
+type DeprecatedAPI struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	// DeprecatedIn is the Kubernetes version in which the API is deprecated. e.g. 1.21
+	DeprecatedIn string `yaml:"deprecatedIn,omitempty"`
+	// RemovedIn is the Kubernetes version in which the API is removed. e.g. 1.25
+	RemovedIn string `yaml:"removedIn,omitempty"`
+	// Replacement is the apiVersion to migrate to. e.g. policy/v1
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// RendererConfig defines how to render the manifests instead of 'helm template' command.
+// Either File or Command can be specified.
+type RendererConfig struct {
+	// File is a path to a pre-rendered manifests file.
+	File string `yaml:"file,omitempty"`
+	// Command is a command and its args to render manifests. The output of the command is snapshotted.
+	Command []string `yaml:"command,omitempty"`
+}
+
 // Merge merges the snapshot configs into the current snapshot config
 // The current snapshot config has higher priority than the given snapshot config
 func (t *SnapshotConfig) Merge(cfg SnapshotConfig) {
 	// For DynamicFields, it doesn't matter if the same field is replaced with a fixed value several times
 	// But the current snapshot config has higher priority than the given snapshot config
 	t.DynamicFields = append(cfg.DynamicFields, t.DynamicFields...)
+
+	// For Matrix, the current snapshot config overrides the given snapshot config
+	if len(t.Matrix) == 0 {
+		t.Matrix = cfg.Matrix
+	}
+
+	// For Renderer, the current snapshot config overrides the given snapshot config
+	if t.Renderer == nil {
+		t.Renderer = cfg.Renderer
+	}
+
+	t.SnapshotStderr = t.SnapshotStderr || cfg.SnapshotStderr
+	t.IgnoreStderrPatterns = append(cfg.IgnoreStderrPatterns, t.IgnoreStderrPatterns...)
+	t.RenderNotes = t.RenderNotes || cfg.RenderNotes
+	t.GroupHooks = t.GroupHooks || cfg.GroupHooks
+	t.ValidateSchema = t.ValidateSchema || cfg.ValidateSchema
+	t.ValidateCRDs = t.ValidateCRDs || cfg.ValidateCRDs
+	t.ValidateReferences = t.ValidateReferences || cfg.ValidateReferences
+	t.ExternalReferences = append(cfg.ExternalReferences, t.ExternalReferences...)
+
+	// For DeprecatedAPIs, the later entries override the former ones of the same apiVersion and kind
+	t.DeprecatedAPIs = append(cfg.DeprecatedAPIs, t.DeprecatedAPIs...)
+	t.AllowedValuesKeys = append(cfg.AllowedValuesKeys, t.AllowedValuesKeys...)
+
+	// For ExpectError, the current snapshot config overrides the given snapshot config
+	if t.ExpectError == "" {
+		t.ExpectError = cfg.ExpectError
+	}
 }
@@ -97,6 +97,21 @@ var _ = Describe("TestSpec", func() {
 			cfg1.Merge(cfg2)
 			Expect(cfg1).To(MatchSnapShot())
 		})
+
+		It("should override matrix only if it is not specified", func() {
+			cfg1 := SnapshotConfig{}
+			cfg2 := SnapshotConfig{
+				Matrix: []MatrixEntry{{KubeVersion: "1.25"}},
+			}
+			cfg1.Merge(cfg2)
+			Expect(cfg1.Matrix).To(Equal([]MatrixEntry{{KubeVersion: "1.25"}}))
+
+			cfg3 := SnapshotConfig{
+				Matrix: []MatrixEntry{{KubeVersion: "1.29"}},
+			}
+			cfg3.Merge(cfg2)
+			Expect(cfg3.Matrix).To(Equal([]MatrixEntry{{KubeVersion: "1.29"}}))
+		})
 	})
 
 })
@@ -144,3 +159,91 @@ func TestManifestPath_DynamicValue(t *testing.T) {
 		})
 	}
 }
+
+func TestMatrixEntry_ID(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry MatrixEntry
+		want  string
+	}{
+		{
+			name:  "empty",
+			entry: MatrixEntry{},
+			want:  "",
+		},
+		{
+			name:  "kube version",
+			entry: MatrixEntry{KubeVersion: "1.25"},
+			want:  "k8s-1.25",
+		},
+		{
+			name:  "kube version with v prefix",
+			entry: MatrixEntry{KubeVersion: "v1.29.0"},
+			want:  "k8s-1.29.0",
+		},
+		{
+			name:  "kube version and api versions",
+			entry: MatrixEntry{KubeVersion: "1.25", APIVersions: []string{"policy/v1", "monitoring.coreos.com/v1"}},
+			want:  "k8s-1.25+policy-v1+monitoring.coreos.com-v1",
+		},
+		{
+			name:  "name is prior to generated one",
+			entry: MatrixEntry{Name: "legacy", KubeVersion: "1.25"},
+			want:  "legacy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.ID(); got != tt.want {
+				t.Errorf("MatrixEntry.ID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		matrix  []MatrixEntry
+		wantErr string
+	}{
+		{
+			name:   "no matrix",
+			matrix: nil,
+		},
+		{
+			name:   "unique ids",
+			matrix: []MatrixEntry{{KubeVersion: "1.25"}, {KubeVersion: "1.29"}, {Name: "legacy", KubeVersion: "1.25"}},
+		},
+		{
+			name:    "same kube version",
+			matrix:  []MatrixEntry{{KubeVersion: "1.25"}, {KubeVersion: "1.29"}, {KubeVersion: "v1.25"}},
+			wantErr: "matrix entries #0 and #2 have the same id 'k8s-1.25'. set a unique name to each entry",
+		},
+		{
+			name:    "name colliding with generated id",
+			matrix:  []MatrixEntry{{KubeVersion: "1.25"}, {Name: "k8s-1.25", KubeVersion: "1.29"}},
+			wantErr: "matrix entries #0 and #1 have the same id 'k8s-1.25'. set a unique name to each entry",
+		},
+		{
+			name:    "empty entries",
+			matrix:  []MatrixEntry{{}, {}},
+			wantErr: "matrix entries #0 and #1 have the same id ''. set a unique name to each entry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := SnapshotConfig{Matrix: tt.matrix}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("SnapshotConfig.Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("SnapshotConfig.Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package charts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/sync/errgroup"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+// the value to perturb strings, nulls and empty collections.
+const perturbedValue = "chartsnap-perturbed"
+
+// ValuesAnalyzer perturbs each leaf key of the chart's values.yaml and re-renders the chart
+// to find the values keys which have no effect on the manifests.
+type ValuesAnalyzer struct {
+	// HelmTemplateCmdOptions is the base options to render the chart. ValuesFile is replaced with each test values file.
+	HelmTemplateCmdOptions HelmTemplateCmdOptions
+	// SnapshotConfig is used to replace the dynamic fields not to detect random values as changes.
+	SnapshotConfig v1alpha1.SnapshotConfig
+	// TestValuesFiles are the test values files. A key is effective if perturbing it changes the manifests
+	// of the default values or any of the test values, e.g. a key used only when a feature is enabled by a test case.
+	TestValuesFiles []string
+	// Parallelism is the number of the renderings in parallel. Unlimited if negative.
+	Parallelism int
+}
+
+// ValuesReport is the result of the values analysis.
+type ValuesReport struct {
+	Total     int              `json:"total"`
+	Dead      int              `json:"dead"`
+	Exercised int              `json:"exercised"`
+	Keys      []ValuesKeyEntry `json:"keys"`
+}
+
+// ValuesKeyEntry is the result of a leaf key of the chart values.
+type ValuesKeyEntry struct {
+	// Key is the dot-separated path of the key. e.g. image.tag
+	Key string `json:"key"`
+	// Effective is true if perturbing the value changed the manifests.
+	Effective bool `json:"effective"`
+	// TestCases are the test values files which set the key.
+	TestCases []string `json:"testCases"`
+}
+
+// valuesLeaf is a leaf of the values tree.
+type valuesLeaf struct {
+	path []string
+	node *kyaml.Node
+}
+
+func (l valuesLeaf) key() string {
+	return strings.Join(l.path, ".")
+}
+
+// Analyze renders the chart for each perturbed key and each test case and reports the dead keys
+// and the keys set by the test values files.
+func (a *ValuesAnalyzer) Analyze(ctx context.Context) (*ValuesReport, error) {
+	b, err := readChartFile(a.HelmTemplateCmdOptions.Chart, "values.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values.yaml of the chart: %w", err)
+	}
+	leaves, err := valuesLeaves(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values.yaml of the chart: %w", err)
+	}
+
+	cases := append([]string{""}, a.TestValuesFiles...)
+	baselines := make([][]byte, len(cases))
+	for i, v := range cases {
+		if baselines[i], err = a.render(ctx, v, nil); err != nil {
+			return nil, err
+		}
+		// the perturbation cannot be detected if the manifests change at every rendering
+		again, err := a.render(ctx, v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(baselines[i], again) {
+			return nil, fmt.Errorf("manifests of values '%s' differ at each rendering. set dynamicFields for the random values", v)
+		}
+	}
+
+	exercised, err := a.exercisedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValuesReport{Total: len(leaves), Keys: make([]ValuesKeyEntry, len(leaves))}
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(a.Parallelism)
+	for i, l := range leaves {
+		e := &report.Keys[i]
+		e.Key = l.key()
+		e.TestCases = make([]string, 0)
+		for _, v := range a.TestValuesFiles {
+			if exercises(exercised[v], l.path) {
+				e.TestCases = append(e.TestCases, v)
+			}
+		}
+
+		eg.Go(func() error {
+			override, err := perturbedValuesFile(l)
+			if err != nil {
+				return err
+			}
+			defer os.Remove(override)
+
+			for j, v := range cases {
+				out, err := a.render(ctx, v, []string{"--values=" + override})
+				if err != nil {
+					// a perturbation breaking the templates is an effect of the key
+					log().Debug("rendering perturbed values failed", "key", e.Key, "values", v, "err", err)
+					e.Effective = true
+					return nil
+				}
+				if !bytes.Equal(baselines[j], out) {
+					e.Effective = true
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range report.Keys {
+		if !e.Effective {
+			report.Dead++
+		}
+		if len(e.TestCases) > 0 {
+			report.Exercised++
+		}
+	}
+	return report, nil
+}
+
+// render returns the normalized manifests of the values file with the additional args.
+func (a *ValuesAnalyzer) render(ctx context.Context, valuesFile string, args []string) ([]byte, error) {
+	ht := a.HelmTemplateCmdOptions
+	ht.ValuesFile = valuesFile
+	ht.AdditionalArgs = append(append([]string{}, ht.AdditionalArgs...), args...)
+	s := &ChartSnapshotter{HelmTemplateCmdOptions: ht, SnapshotConfig: a.SnapshotConfig, FailHelmError: true}
+	return s.Render(ctx)
+}
+
+// exercisedKeys returns the leaf paths set by each test values file except testSpec.
+func (a *ValuesAnalyzer) exercisedKeys() (map[string][][]string, error) {
+	exercised := make(map[string][][]string)
+	for _, v := range a.TestValuesFiles {
+		b, err := os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file: %w", err)
+		}
+		leaves, err := valuesLeaves(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode values file '%s': %w", v, err)
+		}
+		for _, l := range leaves {
+			if l.path[0] != testSpecKey {
+				exercised[v] = append(exercised[v], l.path)
+			}
+		}
+	}
+	return exercised, nil
+}
+
+// exercises returns true if any of the paths sets the key, its parent or its children.
+func exercises(paths [][]string, key []string) bool {
+	for _, p := range paths {
+		n := min(len(p), len(key))
+		if strings.Join(p[:n], "\x00") == strings.Join(key[:n], "\x00") {
+			return true
+		}
+	}
+	return false
+}
+
+// valuesLeaves returns the leaves of the values in the order of the document.
+// Scalars, sequences and empty mappings are leaves.
+func valuesLeaves(b []byte) ([]valuesLeaf, error) {
+	leaves := make([]valuesLeaf, 0)
+	if len(bytes.TrimSpace(b)) == 0 {
+		return leaves, nil
+	}
+	node, err := kyaml.Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	var walk func(path []string, n *kyaml.Node)
+	walk = func(path []string, n *kyaml.Node) {
+		if n.Kind != kyaml.MappingNode || len(n.Content) == 0 {
+			if len(path) > 0 {
+				leaves = append(leaves, valuesLeaf{path: path, node: n})
+			}
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			walk(append(append([]string{}, path...), n.Content[i].Value), n.Content[i+1])
+		}
+	}
+	walk(nil, node.YNode())
+	return leaves, nil
+}
+
+// perturb returns a value different from the leaf.
+// Booleans are toggled, numbers are incremented and the others are replaced.
+func perturb(n *kyaml.Node) (any, error) {
+	var v any
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch t := v.(type) {
+	case bool:
+		return !t, nil
+	case int:
+		return t + 1, nil
+	case float64:
+		return t + 0.5, nil
+	case string:
+		if t == "" {
+			return perturbedValue, nil
+		}
+		return t + "-" + perturbedValue, nil
+	case []any:
+		if len(t) > 0 {
+			return []any{}, nil
+		}
+		return []any{perturbedValue}, nil
+	case map[string]any:
+		return map[string]any{perturbedValue: perturbedValue}, nil
+	default:
+		return perturbedValue, nil
+	}
+}
+
+// perturbedValuesFile writes the values file overriding the leaf with the perturbed value into a temporary file.
+func perturbedValuesFile(l valuesLeaf) (string, error) {
+	v, err := perturb(l.node)
+	if err != nil {
+		return "", fmt.Errorf("failed to perturb '%s': %w", l.key(), err)
+	}
+	for i := len(l.path) - 1; i >= 0; i-- {
+		v = map[string]any{l.path[i]: v}
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode perturbed values: %w", err)
+	}
+
+	f, err := os.CreateTemp("", "chartsnap-perturbed-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create perturbed values file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write perturbed values file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Format returns the report in the text or JSON format.
+func (r *ValuesReport) Format(format string) (string, error) {
+	switch format {
+	case CoverageFormatText:
+		return r.String(), nil
+	case CoverageFormatJSON:
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode values report: %w", err)
+		}
+		return string(b) + "\n", nil
+	default:
+		return "", fmt.Errorf("unsupported values report format '%s'", format)
+	}
+}
+
+// String returns the report in the text format.
+func (r *ValuesReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Values keys: %d, dead: %d, exercised by test cases: %d\n", r.Total, r.Dead, r.Exercised)
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, e := range r.Keys {
+		effect := "effective"
+		if !e.Effective {
+			effect = "dead"
+		}
+		testCases := "-"
+		if len(e.TestCases) > 0 {
+			testCases = strings.Join(e.TestCases, ",")
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", e.Key, effect, testCases)
+	}
+	tw.Flush()
+	return sb.String()
+}
@@ -0,0 +1,84 @@
+package charts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+func TestPerturb(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  any
+	}{
+		{name: "bool", value: "true", want: false},
+		{name: "int", value: "1", want: 2},
+		{name: "float", value: "0.5", want: 1.0},
+		{name: "string", value: "nginx", want: "nginx-chartsnap-perturbed"},
+		{name: "empty string", value: `""`, want: "chartsnap-perturbed"},
+		{name: "null", value: "null", want: "chartsnap-perturbed"},
+		{name: "list", value: "[a, b]", want: []any{}},
+		{name: "empty list", value: "[]", want: []any{"chartsnap-perturbed"}},
+		{name: "empty map", value: "{}", want: map[string]any{"chartsnap-perturbed": "chartsnap-perturbed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := perturb(kyaml.MustParse(tt.value).YNode())
+			if err != nil {
+				t.Fatalf("perturb() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("perturb() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+var _ = Describe("ValuesAnalyzer", func() {
+	a := ValuesAnalyzer{
+		HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+			HelmPath:    "./testdata/helm_analyze.bash",
+			ReleaseName: "chartsnap",
+			Chart:       "testdata/analyze",
+		},
+		TestValuesFiles: []string{"testdata/analyze/tests/test_image.yaml", "testdata/analyze/tests/test_ingress.yaml"},
+		Parallelism:     -1,
+	}
+
+	It("should report dead keys and the keys exercised by test cases", func() {
+		report, err := a.Analyze(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.String()).To(MatchSnapShot())
+
+		out, err := report.Format(CoverageFormatJSON)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchSnapShot())
+	})
+
+	It("should not detect the keys used only when a feature is enabled without test cases", func() {
+		a := a
+		a.TestValuesFiles = nil
+		report, err := a.Analyze(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Dead).To(Equal(2))
+		Expect(report.Exercised).To(Equal(0))
+	})
+
+	It("should fail if the manifests differ at each rendering", func() {
+		helm := filepath.Join(GinkgoT().TempDir(), "helm")
+		Expect(os.WriteFile(helm, []byte("#!/bin/bash\necho \"random: $RANDOM$RANDOM\"\n"), 0755)).To(Succeed())
+		a := a
+		a.HelmTemplateCmdOptions.HelmPath = helm
+		_, err := a.Analyze(context.Background())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("differ at each rendering"))
+	})
+})
@@ -0,0 +1,35 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+// CompareResult is the result of comparing the manifests of a test case rendered by two charts.
+type CompareResult struct {
+	// Equal is true if the normalized manifests are the same.
+	Equal bool
+	// Diff is the diff from the manifests of the source chart to the target chart.
+	Diff string
+}
+
+// Compare renders the manifests of the same test case by the from and to snapshotters and returns the diff.
+// The dynamic fields are replaced with the fixed values in both, but the snapshots are neither matched nor written.
+func Compare(ctx context.Context, from, to *ChartSnapshotter, diffContextLineN int) (*CompareResult, error) {
+	x, err := from.Render(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", from.HelmTemplateCmdOptions.Chart, err)
+	}
+	y, err := to.Render(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", to.HelmTemplateCmdOptions.Chart, err)
+	}
+
+	if string(x) == string(y) {
+		return &CompareResult{Equal: true}, nil
+	}
+	diff := (&yaml.DiffOptions{ContextLineN: diffContextLineN}).Diff
+	return &CompareResult{Diff: diff(string(x), string(y))}, nil
+}
@@ -0,0 +1,66 @@
+package charts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+var _ = Describe("Compare", func() {
+	cfg := v1alpha1.SnapshotConfig{
+		DynamicFields: []v1alpha1.ManifestPath{
+			{APIVersion: "v1", Kind: "Secret", Name: "app-secret", JSONPath: []string{"/data/token"}, Base64: true},
+		},
+	}
+	snapshotter := func(manifests string) *ChartSnapshotter {
+		return &ChartSnapshotter{
+			SnapshotConfig: cfg,
+			Renderer:       &ReaderRenderer{Reader: bytes.NewBufferString(manifests), Source: "test"},
+		}
+	}
+	manifests := `apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secret
+data:
+  token: %s
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  version: %s
+`
+
+	It("should be equal if only the dynamic fields differ", func() {
+		result, err := Compare(context.Background(),
+			snapshotter(fmt.Sprintf(manifests, "cmFuZG9t", "1.2.0")),
+			snapshotter(fmt.Sprintf(manifests, "Y2hhbmdlZA==", "1.2.0")), 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Equal).To(BeTrue())
+		Expect(result.Diff).To(BeEmpty())
+	})
+
+	It("should return the diff of the manifests", func() {
+		result, err := Compare(context.Background(),
+			snapshotter(fmt.Sprintf(manifests, "cmFuZG9t", "1.2.0")),
+			snapshotter(fmt.Sprintf(manifests, "Y2hhbmdlZA==", "1.3.0")), 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Equal).To(BeFalse())
+		Expect(result.Diff).To(MatchSnapShot())
+	})
+
+	It("should fail if rendering failed", func() {
+		_, err := Compare(context.Background(),
+			&ChartSnapshotter{Renderer: &FileRenderer{Path: "testdata/not-found.yaml"}},
+			snapshotter(fmt.Sprintf(manifests, "cmFuZG9t", "1.2.0")), 3)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,489 @@
+package charts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+// Output formats of the template coverage report.
+const (
+	CoverageFormatText = "text"
+	CoverageFormatJSON = "json"
+)
+
+const sourceCommentPrefix = "# Source: "
+
+const (
+	// branchCollectorName is the name of the ConfigMap appended to the instrumented templates to list the branches taken.
+	branchCollectorName = "chartsnap-branches"
+	branchVariable      = "$chartsnapBranches"
+)
+
+// TemplateCoverage records which templates of the chart rendered at least one resource in the test cases.
+// The templates are identified by the '# Source: CHART/templates/FILE' comments in the 'helm template' output.
+//
+// For the chart directory, it also records which if branches of the templates were taken.
+// The branches are marked in a copy of the chart, which is rendered in addition to the test case.
+// It is safe to add the test cases in parallel.
+type TemplateCoverage struct {
+	templates []string
+	branches  []TemplateBranch
+	// instrumented is the copy of the chart with the branch markers. empty for the chart archive.
+	instrumented string
+
+	mu       sync.Mutex
+	rendered map[string]map[string]struct{}
+	taken    map[int]map[string]struct{}
+}
+
+// TemplateBranch is a branch of an if action in a template.
+type TemplateBranch struct {
+	// Template is the path of the template file in the chart. e.g. templates/hpa.yaml
+	Template string `json:"-"`
+	// Line is the line of the if, else if or else action. The implicit else is at the line of the if action.
+	Line int `json:"line"`
+	// Clause is if, else if or else.
+	Clause string `json:"clause"`
+}
+
+// TemplateCoverageReport is the result of the template coverage.
+type TemplateCoverageReport struct {
+	Covered    int     `json:"covered"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"`
+	// BranchesCovered and BranchesTotal are the number of the if branches taken and all. 0 for the chart archive.
+	BranchesCovered  int                     `json:"branchesCovered"`
+	BranchesTotal    int                     `json:"branchesTotal"`
+	BranchPercentage float64                 `json:"branchPercentage"`
+	Templates        []TemplateCoverageEntry `json:"templates"`
+}
+
+// TemplateCoverageEntry is the coverage of a template file.
+type TemplateCoverageEntry struct {
+	// Template is the path of the template file in the chart. e.g. templates/hpa.yaml
+	Template string `json:"template"`
+	// TestCases are the test cases in which the template rendered at least one resource.
+	TestCases []string `json:"testCases"`
+	// Branches are the if branches of the template in the order of the lines.
+	Branches []TemplateBranchEntry `json:"branches,omitempty"`
+}
+
+// TemplateBranchEntry is the coverage of an if branch.
+type TemplateBranchEntry struct {
+	TemplateBranch
+	// TestCases are the test cases in which the branch was taken.
+	TestCases []string `json:"testCases"`
+}
+
+// NewTemplateCoverage returns the template coverage of the chart directory or the chart archive.
+// Partials starting with '_', NOTES.txt and the templates of the subcharts are not counted.
+// Close must be called to remove the instrumented copy of the chart directory.
+func NewTemplateCoverage(chart string) (*TemplateCoverage, error) {
+	stat, err := os.Stat(chart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart templates: %w", err)
+	}
+	var templates []string
+	if stat.IsDir() {
+		templates, err = listTemplatesDir(chart)
+	} else {
+		templates, err = listTemplatesArchive(chart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart templates: %w", err)
+	}
+	sort.Strings(templates)
+	c := &TemplateCoverage{templates: templates, rendered: make(map[string]map[string]struct{}), taken: make(map[int]map[string]struct{})}
+	if stat.IsDir() {
+		if err := c.instrument(chart); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// instrument copies the chart directory and inserts the branch markers into the templates.
+func (c *TemplateCoverage) instrument(chart string) error {
+	abs, err := filepath.Abs(chart)
+	if err != nil {
+		return fmt.Errorf("failed to instrument chart: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "chartsnap-coverage-*")
+	if err != nil {
+		return fmt.Errorf("failed to instrument chart: %w", err)
+	}
+	c.instrumented = filepath.Join(dir, filepath.Base(abs))
+	if err := copyDir(abs, c.instrumented); err != nil {
+		return fmt.Errorf("failed to copy chart: %w", err)
+	}
+	for _, t := range c.templates {
+		b, err := os.ReadFile(filepath.Join(abs, filepath.FromSlash(t)))
+		if err != nil {
+			return fmt.Errorf("failed to read chart template: %w", err)
+		}
+		branches, content := instrumentBranches(t, b, len(c.branches))
+		if len(branches) == 0 {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(c.instrumented, filepath.FromSlash(t)), content, 0644); err != nil {
+			return fmt.Errorf("failed to instrument chart template: %w", err)
+		}
+		c.branches = append(c.branches, branches...)
+	}
+	return nil
+}
+
+// Close removes the instrumented copy of the chart.
+func (c *TemplateCoverage) Close() error {
+	if c.instrumented == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Dir(c.instrumented))
+}
+
+// instrumentBranches inserts a marker into each branch of the if actions outside the define blocks.
+// The marker sets the index of the branch, starting from the offset, in a dictionary of the template,
+// which is listed by the ConfigMap appended to the template. An else branch is added to the if action without else.
+// The markers write nothing and keep the trim markers, so the output of the template is not changed except the ConfigMap.
+func instrumentBranches(template string, content []byte, offset int) ([]TemplateBranch, []byte) {
+	type block struct {
+		keyword      string
+		line         int
+		instrumented bool
+		hasElse      bool
+	}
+	branches := make([]TemplateBranch, 0)
+	stack := make([]*block, 0)
+	inDefine := func() bool {
+		for _, b := range stack {
+			if b.keyword == "define" || b.keyword == "block" {
+				return true
+			}
+		}
+		return false
+	}
+	mark := func(line int, clause string, trimRight bool) string {
+		branches = append(branches, TemplateBranch{Template: template, Line: line, Clause: clause})
+		trim := ""
+		if trimRight {
+			trim = " -"
+		}
+		return fmt.Sprintf(`{{ $_ := set %s "%d" true%s}}`, branchVariable, offset+len(branches)-1, trim)
+	}
+
+	var out bytes.Buffer
+	last := 0
+	insert := func(pos int, s string) {
+		out.Write(content[last:pos])
+		out.WriteString(s)
+		last = pos
+	}
+	for _, loc := range templateActionRegexp.FindAllSubmatchIndex(content, -1) {
+		action := string(content[loc[0]:loc[1]])
+		fields := strings.Fields(string(content[loc[2]:loc[3]]))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "/*") {
+			continue
+		}
+		line := 1 + bytes.Count(content[:loc[0]], []byte("\n"))
+		trimRight := strings.HasSuffix(action, "-}}")
+
+		switch fields[0] {
+		case "if":
+			b := &block{keyword: "if", line: line, instrumented: !inDefine()}
+			if b.instrumented {
+				insert(loc[1], mark(line, "if", trimRight))
+			}
+			stack = append(stack, b)
+		case "range", "with", "define", "block":
+			stack = append(stack, &block{keyword: fields[0]})
+		case "else":
+			if len(stack) == 0 {
+				continue
+			}
+			b := stack[len(stack)-1]
+			if b.keyword != "if" || !b.instrumented {
+				continue
+			}
+			clause := "else"
+			if len(fields) > 1 && fields[1] == "if" {
+				clause = "else if"
+			} else {
+				b.hasElse = true
+			}
+			insert(loc[1], mark(line, clause, trimRight))
+		case "end":
+			if len(stack) == 0 {
+				continue
+			}
+			b := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if b.keyword != "if" || !b.instrumented || b.hasElse {
+				continue
+			}
+			elseAction := "{{ else }}"
+			if strings.HasPrefix(action, "{{-") {
+				elseAction = "{{- else }}"
+			}
+			insert(loc[0], elseAction+mark(b.line, "else", false))
+		}
+	}
+	if len(branches) == 0 {
+		return branches, content
+	}
+	out.Write(content[last:])
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "{{ %s := dict }}", branchVariable)
+	sb.Write(out.Bytes())
+	fmt.Fprintf(&sb, `{{ "\n---\n" }}apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+data:
+{{- range $k, $_ := %s }}
+  {{ $k | quote }}: "true"
+{{- end }}
+`, branchCollectorName, branchVariable)
+	return branches, []byte(sb.String())
+}
+
+func isTemplate(name string) bool {
+	base := path.Base(name)
+	return !strings.HasPrefix(base, "_") && name != "templates/NOTES.txt"
+}
+
+func listTemplatesDir(chart string) ([]string, error) {
+	templates := make([]string, 0)
+	dir := filepath.Join(chart, "templates")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return templates, nil
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(chart, p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); isTemplate(name) {
+			templates = append(templates, name)
+		}
+		return nil
+	})
+	return templates, err
+}
+
+// listTemplatesArchive lists the templates in the top directory of the chart archive.
+func listTemplatesArchive(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	templates := make([]string, 0)
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return templates, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart archive: %w", err)
+		}
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+		if _, name, ok := strings.Cut(h.Name, "/"); ok && strings.HasPrefix(name, "templates/") && isTemplate(name) {
+			templates = append(templates, name)
+		}
+	}
+}
+
+// Add records the templates rendered in the 'helm template' output of the test case.
+func (c *TemplateCoverage) Add(testCase string, stdout []byte) error {
+	manifests, err := yaml.Decode(stdout)
+	if err != nil {
+		return fmt.Errorf("failed to decode manifests: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range manifests {
+		for _, line := range strings.Split(headComment(m), "\n") {
+			source, ok := strings.CutPrefix(line, sourceCommentPrefix)
+			if !ok {
+				continue
+			}
+			// trim the chart name. e.g. app1/templates/hpa.yaml -> templates/hpa.yaml
+			_, template, _ := strings.Cut(strings.TrimSpace(source), "/")
+			if c.rendered[template] == nil {
+				c.rendered[template] = make(map[string]struct{})
+			}
+			c.rendered[template][testCase] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// AddBranches renders the instrumented copy of the chart with the options of the test case
+// and records the if branches taken. It does nothing for the chart archive.
+func (c *TemplateCoverage) AddBranches(ctx context.Context, testCase string, ht HelmTemplateCmdOptions) error {
+	if c.instrumented == "" || len(c.branches) == 0 {
+		return nil
+	}
+	ht.Chart = c.instrumented
+	ht.RenderNotes = false
+	out, err := ht.Render(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to render instrumented chart: %w", err)
+	}
+	return c.addBranches(testCase, out.Stdout)
+}
+
+// addBranches records the if branches listed in the output of the instrumented chart.
+func (c *TemplateCoverage) addBranches(testCase string, stdout []byte) error {
+	manifests, err := yaml.Decode(stdout)
+	if err != nil {
+		return fmt.Errorf("failed to decode manifests: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range manifests {
+		if m.GetKind() != "ConfigMap" || m.GetName() != branchCollectorName {
+			continue
+		}
+		for k := range m.GetDataMap() {
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(c.branches) {
+				continue
+			}
+			if c.taken[i] == nil {
+				c.taken[i] = make(map[string]struct{})
+			}
+			c.taken[i][testCase] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// headComment returns the comments above the document.
+// kyaml attaches them to the first key of the mapping document.
+func headComment(m *kyaml.RNode) string {
+	n := m.YNode()
+	if n.HeadComment == "" && n.Kind == kyaml.MappingNode && len(n.Content) > 0 {
+		return n.Content[0].HeadComment
+	}
+	return n.HeadComment
+}
+
+// Report returns the coverage of the templates in the order of the file names.
+func (c *TemplateCoverage) Report() *TemplateCoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &TemplateCoverageReport{Total: len(c.templates), Percentage: 100, BranchesTotal: len(c.branches), BranchPercentage: 100,
+		Templates: make([]TemplateCoverageEntry, 0, len(c.templates))}
+	for _, t := range c.templates {
+		e := TemplateCoverageEntry{Template: t, TestCases: sortedKeys(c.rendered[t])}
+		if len(e.TestCases) > 0 {
+			r.Covered++
+		}
+		for i, b := range c.branches {
+			if b.Template != t {
+				continue
+			}
+			be := TemplateBranchEntry{TemplateBranch: b, TestCases: sortedKeys(c.taken[i])}
+			if len(be.TestCases) > 0 {
+				r.BranchesCovered++
+			}
+			e.Branches = append(e.Branches, be)
+		}
+		// the implicit else is added after the other branches of the if action
+		sort.SliceStable(e.Branches, func(i, j int) bool { return e.Branches[i].Line < e.Branches[j].Line })
+		r.Templates = append(r.Templates, e)
+	}
+	if r.Total > 0 {
+		r.Percentage = float64(r.Covered) * 100 / float64(r.Total)
+	}
+	if r.BranchesTotal > 0 {
+		r.BranchPercentage = float64(r.BranchesCovered) * 100 / float64(r.BranchesTotal)
+	}
+	return r
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Format returns the report in the text or JSON format.
+func (r *TemplateCoverageReport) Format(format string) (string, error) {
+	switch format {
+	case CoverageFormatText:
+		return r.String(), nil
+	case CoverageFormatJSON:
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode coverage report: %w", err)
+		}
+		return string(b) + "\n", nil
+	default:
+		return "", fmt.Errorf("unsupported coverage format '%s'", format)
+	}
+}
+
+// String returns the report in the text format.
+func (r *TemplateCoverageReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Template coverage: %d/%d (%.1f%%)\n", r.Covered, r.Total, r.Percentage)
+	if r.BranchesTotal > 0 {
+		fmt.Fprintf(&sb, "Branch coverage: %d/%d (%.1f%%)\n", r.BranchesCovered, r.BranchesTotal, r.BranchPercentage)
+	}
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, e := range r.Templates {
+		if len(e.TestCases) == 0 {
+			fmt.Fprintf(tw, "  %s\tnot rendered\n", e.Template)
+		} else {
+			fmt.Fprintf(tw, "  %s\t%d test cases\n", e.Template, len(e.TestCases))
+		}
+		for _, b := range e.Branches {
+			if len(b.TestCases) == 0 {
+				fmt.Fprintf(tw, "    %s:%d %s\tnot taken\n", b.Template, b.Line, b.Clause)
+			}
+		}
+	}
+	tw.Flush()
+	return sb.String()
+}
@@ -0,0 +1,284 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestNewTemplateCoverage(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app1-0.1.0.tgz")
+	writeChartArchive(t, archive,
+		[2]string{"app1/Chart.yaml", "name: app1\nversion: 0.1.0\n"},
+		[2]string{"app1/templates/_helpers.tpl", ""},
+		[2]string{"app1/templates/NOTES.txt", ""},
+		[2]string{"app1/templates/service.yaml", ""},
+		[2]string{"app1/templates/deployment.yaml", ""},
+		[2]string{"app1/charts/sub/templates/configmap.yaml", ""},
+	)
+
+	tests := []struct {
+		name    string
+		chart   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "chart directory",
+			chart: "../../example/app1",
+			want: []string{
+				"templates/cert.yaml",
+				"templates/deployment.yaml",
+				"templates/hpa.yaml",
+				"templates/ingress.yaml",
+				"templates/service.yaml",
+				"templates/serviceaccount.yaml",
+				"templates/tests/test-connection.yaml",
+			},
+		},
+		{
+			name:  "chart archive",
+			chart: archive,
+			want:  []string{"templates/deployment.yaml", "templates/service.yaml"},
+		},
+		{
+			name:    "chart not found",
+			chart:   "testdata/not-found",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTemplateCoverage(tt.chart)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTemplateCoverage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer got.Close()
+			if diff := cmp.Diff(tt.want, got.templates); diff != "" {
+				t.Errorf("NewTemplateCoverage() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInstrumentBranches(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		offset       int
+		wantBranches []TemplateBranch
+		wantContent  string
+	}{
+		{
+			name:    "if without else",
+			content: "{{- if .a }}\na: 1\n{{- end }}\n",
+			offset:  2,
+			wantBranches: []TemplateBranch{
+				{Template: "templates/a.yaml", Line: 1, Clause: "if"},
+				{Template: "templates/a.yaml", Line: 1, Clause: "else"},
+			},
+			wantContent: `{{ $chartsnapBranches := dict }}{{- if .a }}{{ $_ := set $chartsnapBranches "2" true}}
+a: 1
+{{- else }}{{ $_ := set $chartsnapBranches "3" true}}{{- end }}
+`,
+		},
+		{
+			name:    "if, else if and else keeping the trim markers",
+			content: "{{ if .a -}}\na\n{{ else if .b -}}\nb\n{{- else }}\nc\n{{ end }}",
+			wantBranches: []TemplateBranch{
+				{Template: "templates/a.yaml", Line: 1, Clause: "if"},
+				{Template: "templates/a.yaml", Line: 3, Clause: "else if"},
+				{Template: "templates/a.yaml", Line: 5, Clause: "else"},
+			},
+			wantContent: `{{ $chartsnapBranches := dict }}{{ if .a -}}{{ $_ := set $chartsnapBranches "0" true -}}
+a
+{{ else if .b -}}{{ $_ := set $chartsnapBranches "1" true -}}
+b
+{{- else }}{{ $_ := set $chartsnapBranches "2" true}}
+c
+{{ end }}`,
+		},
+		{
+			name:    "nested in range and with",
+			content: "{{ range .a }}{{ with .b }}{{ if . }}x{{ end }}{{ else }}y{{ end }}{{ end }}",
+			wantBranches: []TemplateBranch{
+				{Template: "templates/a.yaml", Line: 1, Clause: "if"},
+				{Template: "templates/a.yaml", Line: 1, Clause: "else"},
+			},
+			wantContent: `{{ $chartsnapBranches := dict }}{{ range .a }}{{ with .b }}{{ if . }}{{ $_ := set $chartsnapBranches "0" true}}x{{ else }}{{ $_ := set $chartsnapBranches "1" true}}{{ end }}{{ else }}y{{ end }}{{ end }}`,
+		},
+		{
+			name:         "if in define and comments are not instrumented",
+			content:      "{{/* {{ if .a }} */}}\n{{- define \"x\" }}{{ if .a }}a{{ end }}{{ end }}",
+			wantBranches: []TemplateBranch{},
+			wantContent:  "{{/* {{ if .a }} */}}\n{{- define \"x\" }}{{ if .a }}a{{ end }}{{ end }}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branches, content := instrumentBranches("templates/a.yaml", []byte(tt.content), tt.offset)
+			if diff := cmp.Diff(tt.wantBranches, branches); diff != "" {
+				t.Errorf("instrumentBranches() branches mismatch (-want +got):\n%s", diff)
+			}
+			want := tt.wantContent
+			if len(tt.wantBranches) > 0 {
+				want += `{{ "\n---\n" }}apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: chartsnap-branches
+data:
+{{- range $k, $_ := $chartsnapBranches }}
+  {{ $k | quote }}: "true"
+{{- end }}
+`
+			}
+			if diff := cmp.Diff(want, string(content)); diff != "" {
+				t.Errorf("instrumentBranches() content mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInstrumentBranches_Execute(t *testing.T) {
+	// the subset of the sprig functions used by the markers
+	funcs := template.FuncMap{
+		"dict":  func() map[string]interface{} { return map[string]interface{}{} },
+		"set":   func(d map[string]interface{}, k string, v interface{}) map[string]interface{} { d[k] = v; return d },
+		"quote": func(s string) string { return fmt.Sprintf("%q", s) },
+	}
+	content := `items:
+{{- range .items }}
+  {{- if eq . "a" }}
+  - a
+  {{- else if eq . "b" -}}
+  {{ printf "\n  - %s" . }}
+  {{- end }}
+{{- end }}
+{{- if .enabled }}
+enabled: true
+{{- else }}
+enabled: false
+{{- end }}
+`
+	tests := []struct {
+		name      string
+		values    map[string]interface{}
+		wantTaken []string
+	}{
+		{
+			name:      "a and b",
+			values:    map[string]interface{}{"items": []string{"a", "b"}, "enabled": true},
+			wantTaken: []string{"templates/a.yaml:3 if", "templates/a.yaml:5 else if", "templates/a.yaml:9 if"},
+		},
+		{
+			name:      "c",
+			values:    map[string]interface{}{"items": []string{"c"}},
+			wantTaken: []string{"templates/a.yaml:3 else", "templates/a.yaml:11 else"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want bytes.Buffer
+			if err := template.Must(template.New("").Funcs(funcs).Parse(content)).Execute(&want, tt.values); err != nil {
+				t.Fatal(err)
+			}
+
+			branches, instrumented := instrumentBranches("templates/a.yaml", []byte(content), 0)
+			var got bytes.Buffer
+			if err := template.Must(template.New("").Funcs(funcs).Parse(string(instrumented))).Execute(&got, tt.values); err != nil {
+				t.Fatal(err)
+			}
+			manifest, collector, ok := strings.Cut(got.String(), "\n---\n")
+			if !ok {
+				t.Fatalf("collector not found: %s", got.String())
+			}
+			if diff := cmp.Diff(want.String(), manifest); diff != "" {
+				t.Errorf("instrumented output mismatch (-want +got):\n%s", diff)
+			}
+
+			c := &TemplateCoverage{branches: branches, taken: make(map[int]map[string]struct{})}
+			if err := c.addBranches(tt.name, []byte(collector)); err != nil {
+				t.Fatal(err)
+			}
+			taken := make([]string, 0)
+			for i, b := range branches {
+				if _, ok := c.taken[i][tt.name]; ok {
+					taken = append(taken, fmt.Sprintf("%s:%d %s", b.Template, b.Line, b.Clause))
+				}
+			}
+			if diff := cmp.Diff(tt.wantTaken, taken); diff != "" {
+				t.Errorf("taken branches mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+var _ = Describe("TemplateCoverage", func() {
+	var report *TemplateCoverageReport
+	BeforeEach(func() {
+		c, err := NewTemplateCoverage("../../example/app1")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(c.Close)
+
+		stub, err := os.ReadFile("../../example/app1/test_latest/__snapshots__/test_hpa_enabled.snap")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Add("test_hpa_enabled.yaml", stub)).To(Succeed())
+		Expect(c.Add("default", []byte("---\n# Source: app1/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: app1\n"))).To(Succeed())
+		Expect(c.Add("empty", nil)).To(Succeed())
+		Expect(c.addBranches("test_hpa_enabled.yaml", []byte("---\n# Source: app1/templates/hpa.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: chartsnap-branches\ndata:\n  \"6\": \"true\"\n  \"7\": \"true\"\n"))).To(Succeed())
+		report = c.Report()
+	})
+
+	It("should report the templates rendered in the test cases", func() {
+		Expect(report.Covered).To(Equal(6))
+		Expect(report.Total).To(Equal(7))
+		Expect(report.BranchesCovered).To(Equal(2))
+		Expect(report.String()).To(MatchSnapShot())
+	})
+
+	It("should format the report in JSON", func() {
+		out, err := report.Format(CoverageFormatJSON)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(MatchSnapShot())
+	})
+
+	It("should fail with unsupported format", func() {
+		_, err := report.Format("xml")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should report 100% for the chart without templates", func() {
+		c, err := NewTemplateCoverage("testdata/umbrella")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(c.Close)
+		Expect(c.Report().Percentage).To(BeEquivalentTo(100))
+		Expect(c.Report().BranchPercentage).To(BeEquivalentTo(100))
+	})
+
+	It("should instrument the templates in the copy of the chart", func() {
+		c, err := NewTemplateCoverage("../../example/app1")
+		Expect(err).NotTo(HaveOccurred())
+		instrumented := c.instrumented
+		Expect(filepath.Base(instrumented)).To(Equal("app1"))
+
+		b, err := os.ReadFile(filepath.Join(instrumented, "templates", "hpa.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(MatchSnapShot())
+		Expect(filepath.Join(instrumented, "Chart.yaml")).To(BeAnExistingFile())
+
+		Expect(c.Close()).To(Succeed())
+		Expect(instrumented).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,310 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+// Dependency is a chart dependency defined in Chart.yaml or Chart.lock
+type Dependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository"`
+	// Alias is the key of the values passed to the dependency instead of the name.
+	Alias string `json:"alias,omitempty"`
+}
+
+func (d Dependency) String() string {
+	return fmt.Sprintf("%s-%s", d.Name, d.Version)
+}
+
+// ArchiveName returns the file name of the dependency archive in the charts directory.
+func (d Dependency) ArchiveName() string {
+	return d.String() + ".tgz"
+}
+
+// IsLocal returns true if the dependency is a local chart referred by 'file://'.
+func (d Dependency) IsLocal() bool {
+	return d.Repository == "" || strings.HasPrefix(d.Repository, "file://")
+}
+
+type chartDependencies struct {
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+func readDependencies(file string) ([]Dependency, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var deps chartDependencies
+	if err := yaml.Unmarshal(b, &deps); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", file, err)
+	}
+	return deps.Dependencies, nil
+}
+
+// IsLocalChart returns true if the chart is a local chart directory.
+func IsLocalChart(chartPath string) bool {
+	_, err := os.Stat(filepath.Join(chartPath, "Chart.yaml"))
+	return err == nil
+}
+
+// StaleDependencies returns the dependencies of the local chart which are not found in the charts directory.
+// The dependencies are compared with the versions locked in Chart.lock.
+// If Chart.lock does not exist or does not have some of the dependencies in Chart.yaml, they are all stale.
+func StaleDependencies(chartPath string) ([]Dependency, error) {
+	deps, err := readDependencies(filepath.Join(chartPath, "Chart.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(deps) == 0 {
+		return nil, nil
+	}
+
+	locked, err := readDependencies(filepath.Join(chartPath, "Chart.lock"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return deps, nil
+		}
+		return nil, err
+	}
+
+	lockedNames := make(map[string]bool, len(locked))
+	for _, d := range locked {
+		lockedNames[d.Name] = true
+	}
+	for _, d := range deps {
+		if !lockedNames[d.Name] {
+			// Chart.lock is out of sync with Chart.yaml
+			return deps, nil
+		}
+	}
+
+	stale := make([]Dependency, 0)
+	for _, d := range locked {
+		if !dependencyExists(chartPath, d) {
+			stale = append(stale, d)
+		}
+	}
+	return stale, nil
+}
+
+// dependencyExists checks the archive or the unpacked directory of the dependency in the charts directory.
+func dependencyExists(chartPath string, d Dependency) bool {
+	if _, err := os.Stat(filepath.Join(chartPath, "charts", d.ArchiveName())); err == nil {
+		return true
+	}
+	unpacked, err := ReadChartMetadata(filepath.Join(chartPath, "charts", d.Name))
+	return err == nil && unpacked.Version == d.Version
+}
+
+// DefaultCacheDir returns the default cache directory of chartsnap.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("HELM_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "chartsnap")
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "helm-chartsnap")
+	}
+	return filepath.Join(dir, "helm-chartsnap")
+}
+
+// DependencyBuilder runs 'helm dependency build' for stale local charts only once per chart.
+// The downloaded archives are cached in CacheDir and reused between runs.
+type DependencyBuilder struct {
+	HelmPath string
+	// CacheDir is the directory to cache the dependency archives. If empty, archives are not cached.
+	CacheDir string
+
+	mu    sync.Mutex
+	built map[string]*dependencyBuild
+}
+
+type dependencyBuild struct {
+	once      sync.Once
+	refreshed []Dependency
+	err       error
+}
+
+// Build refreshes the stale dependencies of the chart and returns them.
+// It is safe to be called concurrently by test cases, and the dependencies are built only once per chart.
+func (b *DependencyBuilder) Build(ctx context.Context, chartPath string) ([]Dependency, error) {
+	key, err := filepath.Abs(chartPath)
+	if err != nil {
+		key = filepath.Clean(chartPath)
+	}
+
+	b.mu.Lock()
+	if b.built == nil {
+		b.built = make(map[string]*dependencyBuild)
+	}
+	build, ok := b.built[key]
+	if !ok {
+		build = &dependencyBuild{}
+		b.built[key] = build
+	}
+	b.mu.Unlock()
+
+	build.once.Do(func() {
+		build.refreshed, build.err = b.build(ctx, chartPath)
+	})
+	return build.refreshed, build.err
+}
+
+func (b *DependencyBuilder) build(ctx context.Context, chartPath string) ([]Dependency, error) {
+	stale, err := StaleDependencies(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check chart dependencies: %w", err)
+	}
+	if len(stale) == 0 {
+		log().DebugContext(ctx, "chart dependencies are up to date", "chart", chartPath)
+		return nil, nil
+	}
+
+	refreshed := make([]Dependency, 0, len(stale))
+	missing := make([]Dependency, 0, len(stale))
+	for _, d := range stale {
+		if restored := b.restore(chartPath, d); restored {
+			log().InfoContext(ctx, "restored chart dependency from cache", "chart", chartPath, "dependency", d.Name, "version", d.Version, "cache", b.CacheDir)
+			refreshed = append(refreshed, d)
+			continue
+		}
+		missing = append(missing, d)
+	}
+	if len(missing) == 0 {
+		return refreshed, nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for _, d := range missing {
+		names = append(names, d.String())
+	}
+	log().InfoContext(ctx, "building stale chart dependencies into the charts directory. use --skip-dependency-build to skip", "chart", chartPath, "dependencies", strings.Join(names, ","))
+	args := []string{"dependency", "build", chartPath}
+	log().DebugContext(ctx, "executing 'helm dependency build' command", "args", args)
+	out, err := runCommand(exec.CommandContext(ctx, b.HelmPath, args...))
+	if err != nil {
+		return nil, fmt.Errorf("'helm dependency build' failed: %w: %s", err, out.Combined())
+	}
+
+	// resolve the versions in Chart.lock because it could be created or updated by the command
+	if locked, err := readDependencies(filepath.Join(chartPath, "Chart.lock")); err == nil {
+		for i, m := range missing {
+			for _, d := range locked {
+				if d.Name == m.Name {
+					missing[i] = d
+				}
+			}
+		}
+	}
+	for _, d := range missing {
+		log().InfoContext(ctx, "refreshed chart dependency", "chart", chartPath, "dependency", d.Name, "version", d.Version, "repository", d.Repository)
+		if err := b.store(chartPath, d); err != nil {
+			log().WarnContext(ctx, "failed to cache chart dependency", "dependency", d.Name, "version", d.Version, "err", err)
+		}
+	}
+	return append(refreshed, missing...), nil
+}
+
+// cachePath returns the path of the cached archive keyed by repository, name and version.
+// Local dependencies are not cached because they can be changed without bumping the version.
+func (b *DependencyBuilder) cachePath(d Dependency) string {
+	if b.CacheDir == "" || d.IsLocal() || d.Version == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(d.Repository))
+	return filepath.Join(b.CacheDir, "dependencies", hex.EncodeToString(sum[:])[:16], d.ArchiveName())
+}
+
+func (b *DependencyBuilder) restore(chartPath string, d Dependency) bool {
+	cache := b.cachePath(d)
+	if cache == "" {
+		return false
+	}
+	if _, err := os.Stat(cache); err != nil {
+		return false
+	}
+	if err := os.MkdirAll(filepath.Join(chartPath, "charts"), 0755); err != nil {
+		return false
+	}
+	if err := removeOtherVersions(chartPath, d); err != nil {
+		return false
+	}
+	return copyFile(cache, filepath.Join(chartPath, "charts", d.ArchiveName())) == nil
+}
+
+// removeOtherVersions removes the archives of the other versions of the dependency in the charts directory
+// not to load two copies of the subchart, as 'helm dependency build' does.
+func removeOtherVersions(chartPath string, d Dependency) error {
+	archives, err := filepath.Glob(filepath.Join(chartPath, "charts", d.Name+"-*.tgz"))
+	if err != nil {
+		return err
+	}
+	for _, archive := range archives {
+		// skip the archives of the other charts whose names start with the same prefix like 'common-lib'
+		v := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), d.Name+"-"), ".tgz")
+		if _, err := version.ParseSemantic(strings.TrimPrefix(v, "v")); err != nil || filepath.Base(archive) == d.ArchiveName() {
+			continue
+		}
+		if err := os.Remove(archive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *DependencyBuilder) store(chartPath string, d Dependency) error {
+	cache := b.cachePath(d)
+	if cache == "" {
+		return nil
+	}
+	archive := filepath.Join(chartPath, "charts", d.ArchiveName())
+	if _, err := os.Stat(archive); err != nil {
+		// unpacked dependencies are not cached
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cache), 0755); err != nil {
+		return err
+	}
+	return copyFile(archive, cache)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+// writeFile writes to a temporary file and renames it not to leave a broken file
+func writeFile(dst string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,141 @@
+package charts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dependency", func() {
+	var chartPath string
+
+	copyChart := func(dir string) string {
+		dst := filepath.Join(dir, "umbrella")
+		Expect(os.MkdirAll(dst, 0755)).To(Succeed())
+		for _, f := range []string{"Chart.yaml", "Chart.lock"} {
+			Expect(copyFile(filepath.Join("testdata/umbrella", f), filepath.Join(dst, f))).To(Succeed())
+		}
+		return dst
+	}
+
+	helmCalls := func(chartPath string) []string {
+		b, err := os.ReadFile(filepath.Join(chartPath, "..", "helm_calls"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+
+	BeforeEach(func() {
+		chartPath = copyChart(GinkgoT().TempDir())
+	})
+
+	Context("StaleDependencies", func() {
+		It("should return the locked dependencies not found in charts directory", func() {
+			stale, err := StaleDependencies(chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(Equal([]Dependency{
+				{Name: "common", Version: "2.19.3", Repository: "https://charts.example.com/stable"},
+				{Name: "app1", Version: "0.1.0", Repository: "file://../app1"},
+			}))
+
+			Expect(os.MkdirAll(filepath.Join(chartPath, "charts", "app1"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(chartPath, "charts", "app1", "Chart.yaml"), []byte("name: app1\nversion: 0.1.0\n"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(chartPath, "charts", "common-2.19.2.tgz"), []byte("old"), 0644)).To(Succeed())
+
+			stale, err = StaleDependencies(chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(Equal([]Dependency{
+				{Name: "common", Version: "2.19.3", Repository: "https://charts.example.com/stable"},
+			}))
+		})
+
+		It("should return all dependencies if Chart.lock does not exist", func() {
+			Expect(os.Remove(filepath.Join(chartPath, "Chart.lock"))).To(Succeed())
+
+			stale, err := StaleDependencies(chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(HaveLen(2))
+			Expect(stale[0].Version).To(Equal("~2.19.0"))
+		})
+
+		It("should return nothing if the chart has no dependencies", func() {
+			stale, err := StaleDependencies("../../example/app1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stale).To(BeEmpty())
+		})
+	})
+
+	Context("DependencyBuilder", func() {
+		It("should build dependencies only once per chart", func() {
+			b := &DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash"}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					refreshed, err := b.Build(context.Background(), chartPath)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(refreshed).To(HaveLen(2))
+				}()
+			}
+			wg.Wait()
+			Expect(helmCalls(chartPath)).To(Equal([]string{"dependency build " + chartPath}))
+
+			// dependencies are up to date in a new run
+			refreshed, err := (&DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash"}).Build(context.Background(), chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed).To(BeEmpty())
+			Expect(helmCalls(chartPath)).To(HaveLen(1))
+		})
+
+		It("should restore the cached archives between runs", func() {
+			cacheDir := GinkgoT().TempDir()
+			b := &DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash", CacheDir: cacheDir}
+			_, err := b.Build(context.Background(), chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(helmCalls(chartPath)).To(HaveLen(1))
+
+			// remote dependency is restored from cache but local dependency is not cached
+			Expect(os.Remove(filepath.Join(chartPath, "charts", "common-2.19.3.tgz"))).To(Succeed())
+			refreshed, err := (&DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash", CacheDir: cacheDir}).Build(context.Background(), chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed).To(Equal([]Dependency{
+				{Name: "common", Version: "2.19.3", Repository: "https://charts.example.com/stable"},
+			}))
+			Expect(helmCalls(chartPath)).To(HaveLen(1))
+			Expect(filepath.Join(chartPath, "charts", "common-2.19.3.tgz")).To(BeARegularFile())
+
+			// the archive of the old version is replaced but the other charts are kept
+			Expect(os.Remove(filepath.Join(chartPath, "charts", "common-2.19.3.tgz"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(chartPath, "charts", "common-2.19.2.tgz"), []byte("old"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(chartPath, "charts", "common-lib-1.0.0.tgz"), []byte("other"), 0644)).To(Succeed())
+			_, err = (&DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash", CacheDir: cacheDir}).Build(context.Background(), chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(helmCalls(chartPath)).To(HaveLen(1))
+			Expect(filepath.Join(chartPath, "charts", "common-2.19.3.tgz")).To(BeARegularFile())
+			Expect(filepath.Join(chartPath, "charts", "common-2.19.2.tgz")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(chartPath, "charts", "common-lib-1.0.0.tgz")).To(BeARegularFile())
+
+			Expect(os.Remove(filepath.Join(chartPath, "charts", "app1-0.1.0.tgz"))).To(Succeed())
+			_, err = (&DependencyBuilder{HelmPath: "./testdata/helm_dependency.bash", CacheDir: cacheDir}).Build(context.Background(), chartPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(helmCalls(chartPath)).To(HaveLen(2))
+		})
+
+		It("should return error if helm dependency build failed", func() {
+			b := &DependencyBuilder{HelmPath: "./testdata/helm_error.bash"}
+			_, err := b.Build(context.Background(), chartPath)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("'helm dependency build' failed"))
+		})
+	})
+})
@@ -0,0 +1,296 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/yaml"
+)
+
+// pullFlags are the flags of 'helm template' which are also passed to 'helm pull' and 'helm show chart'
+// so that the charts are fetched with the same credentials and TLS settings as Helm.
+var (
+	pullFlags     = []string{"--ca-file", "--cert-file", "--key-file", "--keyring", "--password", "--username"}
+	pullBoolFlags = []string{"--devel", "--insecure-skip-tls-verify", "--pass-credentials", "--plain-http", "--verify"}
+)
+
+// RemoteChart is a chart in a Helm repository or an OCI registry.
+type RemoteChart struct {
+	// Repo is the URL of the Helm repository. It is empty for OCI charts.
+	Repo string
+	// Name is the chart name or the OCI reference like 'oci://ghcr.io/org/charts/app'.
+	Name string
+	// Version is the chart version. If empty, the latest version is used.
+	Version string
+	// PullArgs are the additional args of 'helm pull' like credentials.
+	PullArgs []string
+}
+
+func (c *RemoteChart) IsOCI() bool {
+	return strings.HasPrefix(c.Name, "oci://")
+}
+
+func (c *RemoteChart) String() string {
+	s := c.Name
+	if c.Repo != "" {
+		s = c.Repo + " " + s
+	}
+	if c.Version != "" {
+		s += "@" + c.Version
+	}
+	return s
+}
+
+// ParseRemoteChart returns the remote chart referred by the chart and the additional args of 'helm template'.
+// The remote chart is in an OCI registry if the chart starts with 'oci://', or in a Helm repository if '--repo' is set.
+// --repo and --version are removed from the returned args because the chart is rendered from the fetched archive.
+// It returns nil and the given args if the chart is not remote.
+func ParseRemoteChart(chart string, args []string) (*RemoteChart, []string) {
+	c := &RemoteChart{Name: chart}
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue && i+1 < len(args) && (name == "--repo" || name == "--version" || slices.Contains(pullFlags, name)) {
+			value = args[i+1]
+		}
+		switch {
+		case name == "--repo":
+			c.Repo = value
+		case name == "--version":
+			c.Version = value
+		case slices.Contains(pullFlags, name) && (hasValue || i+1 < len(args)):
+			c.PullArgs = append(c.PullArgs, name+"="+value)
+			rest = append(rest, args[i])
+			if !hasValue {
+				rest = append(rest, args[i+1])
+			}
+		case slices.Contains(pullBoolFlags, name):
+			c.PullArgs = append(c.PullArgs, args[i])
+			rest = append(rest, args[i])
+			continue
+		default:
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			i++ // skip the value in the next arg
+		}
+	}
+
+	if c.Repo == "" && !c.IsOCI() {
+		return nil, args
+	}
+	return c, rest
+}
+
+// ChartFetcher fetches remote charts by 'helm pull' into the cache directory only once per chart, repository and version.
+// Every test case renders the cached archive instead of downloading the chart again.
+type ChartFetcher struct {
+	HelmPath string
+	// CacheDir is the directory to cache the chart archives.
+	CacheDir string
+	// Offline uses the cached archives only and fails if the chart is not cached.
+	Offline bool
+
+	mu      sync.Mutex
+	fetched map[string]*chartFetch
+}
+
+type chartFetch struct {
+	once    sync.Once
+	archive string
+	err     error
+}
+
+// Fetch returns the path of the cached archive of the remote chart.
+// It is safe to be called concurrently by test cases, and the chart is fetched only once.
+func (f *ChartFetcher) Fetch(ctx context.Context, c *RemoteChart) (string, error) {
+	key := c.String()
+
+	f.mu.Lock()
+	if f.fetched == nil {
+		f.fetched = make(map[string]*chartFetch)
+	}
+	fetch, ok := f.fetched[key]
+	if !ok {
+		fetch = &chartFetch{}
+		f.fetched[key] = fetch
+	}
+	f.mu.Unlock()
+
+	fetch.once.Do(func() {
+		fetch.archive, fetch.err = f.fetch(ctx, c)
+	})
+	return fetch.archive, fetch.err
+}
+
+func (f *ChartFetcher) fetch(ctx context.Context, c *RemoteChart) (string, error) {
+	dir := f.cacheDir(c)
+	name := path.Base(c.Name)
+
+	if c.Version == "" && f.Offline {
+		if archive := latestCachedArchive(dir, name); archive != "" {
+			log().DebugContext(ctx, "using latest cached remote chart in offline mode", "chart", c.String(), "path", archive)
+			return archive, nil
+		}
+		return "", fmt.Errorf("remote chart %s is not cached. run without --offline to download it", c)
+	}
+
+	ver := c.Version
+	if !isExactVersion(ver) {
+		// resolve the latest version or the version range like '~1.2' once
+		// so that the chart is not pulled again if the resolved version is cached
+		v, err := f.resolveVersion(ctx, c, dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the version of remote chart %s: %w", c, err)
+		}
+		ver = v
+	}
+
+	archive := filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", name, strings.TrimPrefix(ver, "v")))
+	if _, err := os.Stat(archive); err == nil {
+		log().DebugContext(ctx, "using cached remote chart", "chart", c.String(), "version", ver, "path", archive)
+		return archive, nil
+	}
+
+	if f.Offline {
+		return "", fmt.Errorf("remote chart %s is not cached. run without --offline to download it", c)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	archive, err := f.helmPull(ctx, c, ver, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch remote chart %s: %w", c, err)
+	}
+	return archive, nil
+}
+
+// remoteArgs returns the args of 'helm pull' and 'helm show chart' to refer the chart.
+func (c *RemoteChart) remoteArgs(ver string) []string {
+	args := []string{c.Name}
+	if c.Repo != "" {
+		args = append(args, "--repo", c.Repo)
+	}
+	if ver != "" {
+		args = append(args, "--version", ver)
+	}
+	return append(args, c.PullArgs...)
+}
+
+// isExactVersion returns true if the version is a semantic version, not empty or a range like '~1.2' and '>=4.0.0'.
+func isExactVersion(v string) bool {
+	_, err := version.ParseSemantic(strings.TrimPrefix(v, "v"))
+	return err == nil
+}
+
+// resolveVersion returns the version of the chart matching the version range by 'helm show chart', or the latest version if the range is empty.
+// The resolved version is recorded in the cache directory to be used in offline mode.
+func (f *ChartFetcher) resolveVersion(ctx context.Context, c *RemoteChart, dir string) (string, error) {
+	resolved := filepath.Join(dir, "resolved-"+shortHash(c.Version))
+	if f.Offline {
+		b, err := os.ReadFile(resolved)
+		if err != nil {
+			return "", fmt.Errorf("remote chart %s is not cached. run without --offline to download it", c)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	args := append([]string{"show", "chart"}, c.remoteArgs(c.Version)...)
+
+	log().DebugContext(ctx, "executing 'helm show chart' command", "args", args)
+	out, err := runCommand(exec.CommandContext(ctx, f.HelmPath, args...))
+	if err != nil {
+		return "", fmt.Errorf("'helm show chart' failed: %w: %s", err, out.Combined())
+	}
+
+	var meta struct {
+		Version string `json:"version"`
+	}
+	if err := yaml.Unmarshal(out.Stdout, &meta); err != nil {
+		return "", fmt.Errorf("failed to decode chart metadata: %w", err)
+	}
+	if meta.Version == "" {
+		return "", fmt.Errorf("version not found in chart metadata: %s", out.Combined())
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := writeFile(resolved, strings.NewReader(meta.Version)); err != nil {
+		return "", fmt.Errorf("failed to record the resolved version: %w", err)
+	}
+	log().DebugContext(ctx, "resolved remote chart version", "chart", c.String(), "version", meta.Version)
+	return meta.Version, nil
+}
+
+// shortHash returns the short hex of sha256 of the string used in the cache file names.
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// cacheDir returns the cache directory of the chart keyed by repository and name.
+func (f *ChartFetcher) cacheDir(c *RemoteChart) string {
+	return filepath.Join(f.CacheDir, "charts", shortHash(c.Repo+"\n"+c.Name))
+}
+
+// latestCachedArchive returns the cached archive of the latest stable version.
+func latestCachedArchive(dir, name string) string {
+	files, err := filepath.Glob(filepath.Join(dir, name+"-*.tgz"))
+	if err != nil {
+		return ""
+	}
+	var (
+		latest  string
+		latestV *version.Version
+	)
+	for _, file := range files {
+		v, err := version.ParseSemantic(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), name+"-"), ".tgz"))
+		if err != nil || v.PreRelease() != "" {
+			continue
+		}
+		if latestV == nil || v.GreaterThan(latestV) {
+			latest, latestV = file, v
+		}
+	}
+	return latest
+}
+
+func (f *ChartFetcher) helmPull(ctx context.Context, c *RemoteChart, ver, dir string) (string, error) {
+	tmp, err := os.MkdirTemp(dir, "pull")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	args := append([]string{"pull", "--destination", tmp}, c.remoteArgs(ver)...)
+
+	log().DebugContext(ctx, "executing 'helm pull' command", "args", args)
+	out, err := runCommand(exec.CommandContext(ctx, f.HelmPath, args...))
+	if err != nil {
+		return "", fmt.Errorf("'helm pull' failed: %w: %s", err, out.Combined())
+	}
+
+	pulled, err := filepath.Glob(filepath.Join(tmp, "*.tgz"))
+	if err != nil || len(pulled) != 1 {
+		return "", fmt.Errorf("'helm pull' did not create a chart archive: %s", out.Combined())
+	}
+	archive := filepath.Join(dir, filepath.Base(pulled[0]))
+	if err := os.Rename(pulled[0], archive); err != nil {
+		return "", err
+	}
+	log().InfoContext(ctx, "downloaded remote chart", "chart", c.String(), "version", ver, "path", archive)
+	return archive, nil
+}
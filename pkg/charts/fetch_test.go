@@ -0,0 +1,267 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChartFetcher", func() {
+	var (
+		cacheDir string
+		calls    func() string
+	)
+
+	BeforeEach(func() {
+		cacheDir = GinkgoT().TempDir()
+		callsFile := filepath.Join(cacheDir, "helm_calls")
+		GinkgoT().Setenv("HELM_CALLS", callsFile)
+		calls = func() string {
+			b, err := os.ReadFile(callsFile)
+			Expect(err).NotTo(HaveOccurred())
+			return string(b)
+		}
+	})
+
+	newFetcher := func(offline bool) *ChartFetcher {
+		return &ChartFetcher{HelmPath: "./testdata/helm_pull.bash", CacheDir: cacheDir, Offline: offline}
+	}
+
+	Context("chart in Helm repository", func() {
+		It("should pull the chart only once and reuse it across test cases", func() {
+			f := newFetcher(false)
+			c := &RemoteChart{Repo: "https://charts.example.com", Name: "app1", Version: "0.1.0", PullArgs: []string{"--username=user"}}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+					path, err := f.Fetch(context.Background(), c)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(filepath.Base(path)).To(Equal("app1-0.1.0.tgz"))
+				}()
+			}
+			wg.Wait()
+
+			// reuse the cache in a new run
+			_, err := newFetcher(false).Fetch(context.Background(), c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(calls()).To(Equal("pull app1 https://charts.example.com 0.1.0\n"))
+		})
+
+		It("should resolve the latest version and reuse the cache if version is not specified", func() {
+			c := &RemoteChart{Repo: "https://charts.example.com", Name: "app1"}
+			for i := 0; i < 2; i++ {
+				path, err := newFetcher(false).Fetch(context.Background(), c)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Base(path)).To(Equal("app1-1.0.0.tgz"))
+			}
+			Expect(calls()).To(Equal(`show app1 https://charts.example.com
+pull app1 https://charts.example.com 1.0.0
+show app1 https://charts.example.com
+`))
+		})
+
+		It("should resolve the version range and reuse the cache in offline mode", func() {
+			c := &RemoteChart{Repo: "https://charts.example.com", Name: "app1", Version: "~1.2"}
+			_, err := newFetcher(true).Fetch(context.Background(), c)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not cached"))
+
+			for _, offline := range []bool{false, false, true} {
+				path, err := newFetcher(offline).Fetch(context.Background(), c)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Base(path)).To(Equal("app1-1.2.3.tgz"))
+			}
+			Expect(calls()).To(Equal(`show app1 https://charts.example.com ~1.2
+pull app1 https://charts.example.com 1.2.3
+show app1 https://charts.example.com ~1.2
+`))
+		})
+
+		It("should reuse the cache without network in offline mode", func() {
+			c := &RemoteChart{Repo: "https://charts.example.com", Name: "app1", Version: "0.2.0"}
+			_, err := newFetcher(true).Fetch(context.Background(), c)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("is not cached"))
+
+			_, err = newFetcher(false).Fetch(context.Background(), c)
+			Expect(err).NotTo(HaveOccurred())
+
+			path, err := newFetcher(true).Fetch(context.Background(), c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Base(path)).To(Equal("app1-0.2.0.tgz"))
+
+			path, err = newFetcher(true).Fetch(context.Background(), &RemoteChart{Repo: c.Repo, Name: c.Name})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Base(path)).To(Equal("app1-0.2.0.tgz"))
+			Expect(calls()).To(Equal("pull app1 https://charts.example.com 0.2.0\n"))
+		})
+
+		It("should fail if helm fails", func() {
+			f := &ChartFetcher{HelmPath: "false", CacheDir: cacheDir}
+			_, err := f.Fetch(context.Background(), &RemoteChart{Repo: "https://charts.example.com", Name: "app1", Version: "9.9.9"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("'helm pull' failed"))
+
+			_, err = f.Fetch(context.Background(), &RemoteChart{Repo: "https://charts.example.com", Name: "app1"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("'helm show chart' failed"))
+		})
+	})
+
+	Context("chart in local Helm repository", func() {
+		var (
+			repo      *httptest.Server
+			downloads atomic.Int32
+		)
+
+		BeforeEach(func() {
+			if _, err := exec.LookPath("helm"); err != nil {
+				Skip("helm is not installed")
+			}
+			// isolate the repository cache of helm
+			for _, env := range []string{"HELM_CACHE_HOME", "HELM_CONFIG_HOME", "HELM_DATA_HOME"} {
+				GinkgoT().Setenv(env, GinkgoT().TempDir())
+			}
+
+			charts := GinkgoT().TempDir()
+			index := "apiVersion: v1\nentries:\n  app1:\n"
+			for _, v := range []string{"0.2.0", "0.1.1", "0.1.0"} {
+				archive := filepath.Join(charts, "app1-"+v+".tgz")
+				writeChartArchive(GinkgoT(), archive,
+					[2]string{"app1/Chart.yaml", "apiVersion: v2\nname: app1\nversion: " + v + "\n"},
+					[2]string{"app1/templates/configmap.yaml", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app1\n"},
+				)
+				b, err := os.ReadFile(archive)
+				Expect(err).NotTo(HaveOccurred())
+				sum := sha256.Sum256(b)
+				index += fmt.Sprintf("  - apiVersion: v2\n    name: app1\n    version: %s\n    digest: %s\n    urls: [charts/app1-%s.tgz]\n", v, hex.EncodeToString(sum[:]), v)
+			}
+
+			downloads.Store(0)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(index))
+			})
+			mux.Handle("/charts/", http.StripPrefix("/charts/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads.Add(1)
+				http.ServeFile(w, r, filepath.Join(charts, filepath.Base(r.URL.Path)))
+			})))
+			repo = httptest.NewServer(mux)
+			DeferCleanup(repo.Close)
+		})
+
+		It("should pull the chart by helm and reuse the cache in the next runs and offline mode", func() {
+			c := &RemoteChart{Repo: repo.URL, Name: "app1", Version: "~0.1"}
+			f := &ChartFetcher{HelmPath: "helm", CacheDir: cacheDir}
+			path, err := f.Fetch(context.Background(), c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Base(path)).To(Equal("app1-0.1.1.tgz"))
+			meta, err := ReadChartMetadata(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.Version).To(Equal("0.1.1"))
+
+			// the cached archive is used without pulling it again
+			n := downloads.Load()
+			path, err = (&ChartFetcher{HelmPath: "helm", CacheDir: cacheDir}).Fetch(context.Background(), &RemoteChart{Repo: repo.URL, Name: "app1", Version: "0.1.1"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(filepath.Base(path)).To(Equal("app1-0.1.1.tgz"))
+			Expect(downloads.Load()).To(Equal(n))
+
+			repo.Close()
+			for _, v := range []string{"~0.1", "0.1.1", ""} {
+				path, err = (&ChartFetcher{HelmPath: "helm", CacheDir: cacheDir, Offline: true}).Fetch(context.Background(), &RemoteChart{Repo: c.Repo, Name: c.Name, Version: v})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Base(path)).To(Equal("app1-0.1.1.tgz"))
+			}
+		})
+	})
+
+	Context("chart in OCI registry", func() {
+		It("should pull the chart by helm pull only once", func() {
+			c := &RemoteChart{Name: "oci://ghcr.io/jlandowner/charts/app1", Version: "0.1.0"}
+			for i := 0; i < 2; i++ {
+				path, err := newFetcher(false).Fetch(context.Background(), c)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Base(path)).To(Equal("app1-0.1.0.tgz"))
+			}
+			Expect(calls()).To(Equal("pull app1 0.1.0\n"))
+		})
+
+		It("should not pull the chart again without version", func() {
+			c := &RemoteChart{Name: "oci://ghcr.io/jlandowner/charts/app1"}
+			for i := 0; i < 2; i++ {
+				path, err := newFetcher(false).Fetch(context.Background(), c)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Base(path)).To(Equal("app1-1.0.0.tgz"))
+			}
+			Expect(calls()).To(Equal("show app1\npull app1 1.0.0\nshow app1\n"))
+		})
+	})
+})
+
+func TestParseRemoteChart(t *testing.T) {
+	tests := []struct {
+		name     string
+		chart    string
+		args     []string
+		want     *RemoteChart
+		wantArgs []string
+	}{
+		{
+			name:     "local chart",
+			chart:    "example/app1",
+			args:     []string{"--skip-tests", "--version", "0.1.0"},
+			want:     nil,
+			wantArgs: []string{"--skip-tests", "--version", "0.1.0"},
+		},
+		{
+			name:     "helm repository",
+			chart:    "ingress-nginx",
+			args:     []string{"--namespace", "ingress-nginx", "--repo", "https://kubernetes.github.io/ingress-nginx", "--skip-tests", "--version=4.8.3"},
+			want:     &RemoteChart{Repo: "https://kubernetes.github.io/ingress-nginx", Name: "ingress-nginx", Version: "4.8.3"},
+			wantArgs: []string{"--namespace", "ingress-nginx", "--skip-tests"},
+		},
+		{
+			name:     "helm repository with credentials",
+			chart:    "app1",
+			args:     []string{"--repo=https://charts.example.com", "--username", "user", "--password=pass", "--pass-credentials"},
+			want:     &RemoteChart{Repo: "https://charts.example.com", Name: "app1", PullArgs: []string{"--username=user", "--password=pass", "--pass-credentials"}},
+			wantArgs: []string{"--username", "user", "--password=pass", "--pass-credentials"},
+		},
+		{
+			name:     "oci",
+			chart:    "oci://ghcr.io/nginxinc/charts/nginx-gateway-fabric",
+			args:     []string{"--namespace", "nginx-gateway"},
+			want:     &RemoteChart{Name: "oci://ghcr.io/nginxinc/charts/nginx-gateway-fabric"},
+			wantArgs: []string{"--namespace", "nginx-gateway"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotArgs := ParseRemoteChart(tt.chart, tt.args)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseRemoteChart() chart mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantArgs, gotArgs); diff != "" {
+				t.Errorf("ParseRemoteChart() args mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+package charts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/schema"
+	pkgyaml "github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+// Kinds of the failures found by the fuzzing.
+const (
+	FuzzRenderError       = "render-error"
+	FuzzInvalidYAML       = "invalid-yaml"
+	FuzzDuplicateResource = "duplicate-resource"
+)
+
+// the max number of the keys overridden in an iteration.
+const fuzzMaxKeys = 5
+
+// Fuzzer renders the chart with random but type-consistent values overrides generated
+// from values.yaml and values.schema.json, and finds the inputs which break the chart.
+type Fuzzer struct {
+	// HelmTemplateCmdOptions is the base options to render the chart. The overrides are passed by an additional '--values'.
+	HelmTemplateCmdOptions HelmTemplateCmdOptions
+	// Iterations is the number of the random overrides.
+	Iterations int
+	// Seed is the seed of the random overrides. The same seed generates the same overrides.
+	Seed int64
+	// Parallelism is the number of the renderings in parallel. Unlimited if negative.
+	Parallelism int
+}
+
+// FuzzFailure is a failure found by the fuzzing.
+type FuzzFailure struct {
+	// Iteration is the index of the iteration which found the failure.
+	Iteration int
+	// Kind is the kind of the failure. render-error, invalid-yaml or duplicate-resource.
+	Kind string
+	// Message is the error message of helm or the description of the failure.
+	Message string
+	// Values is the minimized values override which reproduces the failure.
+	Values []byte
+}
+
+// fuzzKey is a key of the chart values to override.
+type fuzzKey struct {
+	path   []string
+	node   *kyaml.Node
+	schema *spec.Schema
+}
+
+// fuzzValue is a value overriding a key.
+type fuzzValue struct {
+	path  []string
+	value any
+}
+
+type fuzzResult struct {
+	kind    string
+	message string
+}
+
+// id identifies the failure by the kind and the first line of the message.
+func (r fuzzResult) id() string {
+	return r.kind + ":" + firstLine(r.message)
+}
+
+// Run renders the chart for each iteration and returns the failures with the minimized overrides.
+// The failures of the same kind and message are reported once.
+func (f *Fuzzer) Run(ctx context.Context) ([]FuzzFailure, error) {
+	keys, err := f.keys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no values to fuzz in values.yaml of the chart")
+	}
+	if res, err := f.check(ctx, nil); err != nil {
+		return nil, err
+	} else if res.kind != "" {
+		return nil, fmt.Errorf("chart fails with the default values: %s: %s", res.kind, res.message)
+	}
+
+	// generate the overrides in advance so that they depend only on the seed
+	r := rand.New(rand.NewPCG(uint64(f.Seed), uint64(f.Seed)))
+	overrides := make([][]fuzzValue, f.Iterations)
+	for i := range overrides {
+		overrides[i] = generateOverride(r, keys)
+	}
+
+	results := make([]fuzzResult, f.Iterations)
+	eg, egctx := errgroup.WithContext(ctx)
+	eg.SetLimit(f.Parallelism)
+	for i, override := range overrides {
+		eg.Go(func() (err error) {
+			results[i], err = f.check(egctx, override)
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	failures := make([]FuzzFailure, 0)
+	found := make(map[string]bool)
+	for i, res := range results {
+		if res.kind == "" || found[res.id()] {
+			continue
+		}
+		found[res.id()] = true
+
+		minimized, err := f.minimize(ctx, overrides[i], res)
+		if err != nil {
+			return nil, err
+		}
+		b, err := encodeOverride(minimized)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, FuzzFailure{Iteration: i, Kind: res.kind, Message: res.message, Values: b})
+	}
+	return failures, nil
+}
+
+// keys returns the keys to override: the leaves of values.yaml and the mappings which can be null.
+func (f *Fuzzer) keys() ([]fuzzKey, error) {
+	b, err := readChartFile(f.HelmTemplateCmdOptions.Chart, "values.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values.yaml of the chart: %w", err)
+	}
+	values, err := parseValues(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values.yaml of the chart: %w", err)
+	}
+
+	var schema *spec.Schema
+	if b, err := readChartFile(f.HelmTemplateCmdOptions.Chart, "values.schema.json"); err == nil {
+		schema = &spec.Schema{}
+		if err := json.Unmarshal(b, schema); err != nil {
+			return nil, fmt.Errorf("failed to decode values.schema.json of the chart: %w", err)
+		}
+	}
+
+	keys := make([]fuzzKey, 0)
+	var walk func(path []string, n *kyaml.Node, s *spec.Schema)
+	walk = func(path []string, n *kyaml.Node, s *spec.Schema) {
+		if len(path) > 0 {
+			keys = append(keys, fuzzKey{path: path, node: n, schema: s})
+		}
+		if n.Kind != kyaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			var child *spec.Schema
+			if s != nil {
+				if p, ok := s.Properties[n.Content[i].Value]; ok {
+					child = &p
+				}
+			}
+			walk(append(append([]string{}, path...), n.Content[i].Value), n.Content[i+1], child)
+		}
+	}
+	walk(nil, values, schema)
+	return keys, nil
+}
+
+// generateOverride picks some keys at random and generates their values.
+func generateOverride(r *rand.Rand, keys []fuzzKey) []fuzzValue {
+	n := 1 + r.IntN(min(fuzzMaxKeys, len(keys)))
+	override := make([]fuzzValue, 0, n)
+	for _, i := range r.Perm(len(keys))[:n] {
+		override = append(override, fuzzValue{path: keys[i].path, value: generateValue(r, keys[i])})
+	}
+	return override
+}
+
+// generateValue returns a random value of the type in the schema or the type of the default value.
+// null is generated occasionally for any type to reach nil pointer errors.
+func generateValue(r *rand.Rand, k fuzzKey) any {
+	if r.IntN(8) == 0 {
+		return nil
+	}
+	if k.schema != nil && len(k.schema.Enum) > 0 {
+		return k.schema.Enum[r.IntN(len(k.schema.Enum))]
+	}
+
+	typ := ""
+	if k.schema != nil {
+		for _, t := range k.schema.Type {
+			if t != "null" {
+				typ = t
+				break
+			}
+		}
+	}
+	if typ == "" {
+		switch {
+		case k.node.Kind == kyaml.MappingNode:
+			typ = "object"
+		case k.node.Kind == kyaml.SequenceNode:
+			typ = "array"
+		case k.node.ShortTag() == kyaml.NodeTagBool:
+			typ = "boolean"
+		case k.node.ShortTag() == kyaml.NodeTagInt:
+			typ = "integer"
+		case k.node.ShortTag() == kyaml.NodeTagFloat:
+			typ = "number"
+		case k.node.ShortTag() == kyaml.NodeTagString:
+			typ = "string"
+		default:
+			// the type of null is unknown
+			typ = []string{"string", "object", "array"}[r.IntN(3)]
+		}
+	}
+
+	switch typ {
+	case "boolean":
+		return r.IntN(2) == 0
+	case "integer":
+		return []int{0, 1, -1, r.IntN(1000)}[r.IntN(4)]
+	case "number":
+		return []float64{0, 0.5, -1.5, float64(r.IntN(100000)) / 100}[r.IntN(4)]
+	case "string":
+		return []string{"", randomString(r, 8), "chartsnap-fuzz"}[r.IntN(3)]
+	case "array":
+		if r.IntN(2) == 0 {
+			return []any{}
+		}
+		var v any
+		if k.node.Kind == kyaml.SequenceNode && len(k.node.Content) > 0 && k.node.Content[0].Decode(&v) == nil {
+			return []any{v, v}
+		}
+		return []any{randomString(r, 8)}
+	default:
+		// object
+		if k.node.Kind == kyaml.MappingNode && len(k.node.Content) > 0 {
+			return map[string]any{}
+		}
+		return map[string]any{randomString(r, 8): randomString(r, 8)}
+	}
+}
+
+func randomString(r *rand.Rand, n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[r.IntN(len(letters))]
+	}
+	return string(b)
+}
+
+// check renders the chart with the override and returns the failure if any.
+func (f *Fuzzer) check(ctx context.Context, override []fuzzValue) (fuzzResult, error) {
+	ht := f.HelmTemplateCmdOptions
+	tmpName := ""
+	if len(override) > 0 {
+		b, err := encodeOverride(override)
+		if err != nil {
+			return fuzzResult{}, err
+		}
+		tmp, err := os.CreateTemp("", "chartsnap-fuzz-*.yaml")
+		if err != nil {
+			return fuzzResult{}, fmt.Errorf("failed to create fuzz values file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(b)
+		tmp.Close()
+		if err != nil {
+			return fuzzResult{}, fmt.Errorf("failed to write fuzz values file: %w", err)
+		}
+		tmpName = tmp.Name()
+		ht.AdditionalArgs = append(append([]string{}, ht.AdditionalArgs...), "--values="+tmpName)
+	}
+
+	out, err := ht.Execute(ctx)
+	if out == nil || out.ExitCode < 0 {
+		return fuzzResult{}, fmt.Errorf("%s failed: %w", ht.Name(), err)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(string(out.Stderr))
+		if tmpName != "" {
+			// the temporary file name differs at each iteration
+			msg = strings.ReplaceAll(msg, tmpName, "fuzz-values.yaml")
+		}
+		return fuzzResult{kind: FuzzRenderError, message: msg}, nil
+	}
+
+	manifests, err := pkgyaml.Decode(out.Stdout)
+	if err != nil {
+		return fuzzResult{kind: FuzzInvalidYAML, message: err.Error()}, nil
+	}
+	if unknown := unknownDocuments(manifests); len(unknown) > 0 {
+		return fuzzResult{kind: FuzzInvalidYAML, message: "failed to recognize a resource: " + unknownSource(unknown)}, nil
+	}
+	if dups := duplicateResources(manifests); len(dups) > 0 {
+		return fuzzResult{kind: FuzzDuplicateResource, message: strings.Join(dups, "\n")}, nil
+	}
+	return fuzzResult{}, nil
+}
+
+// minimize removes the keys of the override one by one while the same failure is reproduced.
+func (f *Fuzzer) minimize(ctx context.Context, override []fuzzValue, failure fuzzResult) ([]fuzzValue, error) {
+	minimized := slices.Clone(override)
+	for i := 0; i < len(minimized) && len(minimized) > 1; {
+		candidate := slices.Delete(slices.Clone(minimized), i, i+1)
+		res, err := f.check(ctx, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if res.id() == failure.id() {
+			minimized = candidate
+		} else {
+			i++
+		}
+	}
+	return minimized, nil
+}
+
+// encodeOverride encodes the override as a values file. The keys conflicting with the former ones are ignored.
+func encodeOverride(override []fuzzValue) ([]byte, error) {
+	values := make(map[string]any)
+OVERRIDE:
+	for _, v := range override {
+		m := values
+		for _, k := range v.path[:len(v.path)-1] {
+			child, ok := m[k]
+			if !ok {
+				child = make(map[string]any)
+				m[k] = child
+			}
+			if m, ok = child.(map[string]any); !ok {
+				continue OVERRIDE
+			}
+		}
+		if _, ok := m[v.path[len(v.path)-1]]; !ok {
+			m[v.path[len(v.path)-1]] = v.value
+		}
+	}
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values override: %w", err)
+	}
+	return b, nil
+}
+
+// duplicateResources returns the identities of the resources rendered more than once.
+// The identity is the API group, kind, namespace and name. e.g. apps/Deployment default/app
+func duplicateResources(manifests []*kyaml.RNode) []string {
+	dups := make([]string, 0)
+	for _, f := range schema.FindDuplicateResources(manifests) {
+		dups = append(dups, "duplicate resource "+f.ID())
+	}
+	return dups
+}
+
+// unknownDocuments returns the raw texts of the documents which are not recognized as resources.
+func unknownDocuments(manifests []*kyaml.RNode) []string {
+	unknown := make([]string, 0)
+	for _, m := range manifests {
+		if m.GetApiVersion() == v1alpha1.GroupVersion.String() && m.GetKind() == "Unknown" {
+			raw, _ := m.GetString("raw")
+			unknown = append(unknown, strings.TrimSpace(raw))
+		}
+	}
+	return unknown
+}
+
+// unknownSource returns the template of the first unrecognized document or its first line.
+// The empty documents converted with the invalid ones are skipped.
+func unknownSource(unknown []string) string {
+	for _, raw := range unknown {
+		if raw == "" {
+			continue
+		}
+		for _, line := range strings.Split(raw, "\n") {
+			if source, ok := strings.CutPrefix(line, sourceCommentPrefix); ok {
+				return strings.TrimSpace(source)
+			}
+		}
+		return firstLine(raw)
+	}
+	return "empty document"
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,140 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+func TestEncodeOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override []fuzzValue
+		want     string
+	}{
+		{
+			name:     "nested",
+			override: []fuzzValue{{path: []string{"image", "tag"}, value: ""}, {path: []string{"replicas"}, value: -1}},
+			want:     "image:\n  tag: \"\"\nreplicas: -1\n",
+		},
+		{
+			name:     "child of null parent is ignored",
+			override: []fuzzValue{{path: []string{"ingress"}, value: nil}, {path: []string{"ingress", "enabled"}, value: true}},
+			want:     "ingress: null\n",
+		},
+		{
+			name:     "parent of the former child is ignored",
+			override: []fuzzValue{{path: []string{"ingress", "enabled"}, value: true}, {path: []string{"ingress"}, value: nil}},
+			want:     "ingress:\n  enabled: true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeOverride(tt.override)
+			if err != nil {
+				t.Fatalf("encodeOverride() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Errorf("encodeOverride() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDuplicateResources(t *testing.T) {
+	manifests, err := yaml.Decode([]byte(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: other
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"duplicate resource apps/Deployment default/app"}
+	if diff := cmp.Diff(want, duplicateResources(manifests)); diff != "" {
+		t.Errorf("duplicateResources() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+var _ = Describe("Fuzzer", func() {
+	f := Fuzzer{
+		HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+			HelmPath:    "./testdata/helm_fuzz.bash",
+			ReleaseName: "chartsnap",
+			Chart:       "testdata/fuzz",
+		},
+		Iterations:  50,
+		Seed:        1,
+		Parallelism: -1,
+	}
+
+	It("should find the minimized values breaking the chart", func() {
+		failures, err := f.Run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(failures).To(ContainElements(
+			HaveField("Kind", FuzzRenderError),
+			HaveField("Kind", FuzzInvalidYAML),
+			HaveField("Kind", FuzzDuplicateResource),
+		))
+		var sb strings.Builder
+		for _, failure := range failures {
+			fmt.Fprintf(&sb, "# %d %s: %s\n%s", failure.Iteration, failure.Kind, failure.Message, failure.Values)
+		}
+		Expect(sb.String()).To(MatchSnapShot())
+	})
+
+	It("should generate the same failures with the same seed", func() {
+		x, err := f.Run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		y, err := f.Run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(x).To(Equal(y))
+	})
+
+	It("should minimize the values keeping the same failure", func() {
+		override := []fuzzValue{{path: []string{"crash"}, value: true}, {path: []string{"name"}, value: ""}}
+		res, err := f.check(context.Background(), override)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.message).To(ContainSubstring("crashed"))
+
+		// removing crash results in another render error of name, which must not replace the failure
+		minimized, err := f.minimize(context.Background(), override, res)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(minimized).To(Equal([]fuzzValue{{path: []string{"crash"}, value: true}}))
+	})
+
+	It("should return error if the chart fails with the default values", func() {
+		f := f
+		f.HelmTemplateCmdOptions.HelmPath = "./testdata/helm_error.bash"
+		_, err := f.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("chart fails with the default values")))
+	})
+})
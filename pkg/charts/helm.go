@@ -2,9 +2,13 @@ package charts
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
+	"strings"
 )
 
 type HelmTemplateCmdOptions struct {
@@ -13,7 +17,11 @@ type HelmTemplateCmdOptions struct {
 	Namespace      string
 	Chart          string
 	ValuesFile     string
+	KubeVersion    string
+	APIVersions    []string
 	AdditionalArgs []string
+	// RenderNotes renders NOTES.txt by 'helm install --dry-run=client' in addition to 'helm template'.
+	RenderNotes bool
 }
 
 func (o *HelmTemplateCmdOptions) Args() []string {
@@ -26,13 +34,82 @@ func (o *HelmTemplateCmdOptions) Args() []string {
 	if o.ValuesFile != "" {
 		args = append(args, fmt.Sprintf("--values=%s", o.ValuesFile))
 	}
+	if o.KubeVersion != "" {
+		args = append(args, fmt.Sprintf("--kube-version=%s", o.KubeVersion))
+	}
+	for _, v := range o.APIVersions {
+		args = append(args, fmt.Sprintf("--api-versions=%s", v))
+	}
 	if len(o.AdditionalArgs) > 0 {
 		args = append(args, o.AdditionalArgs...)
 	}
 	return args
 }
 
-func (o *HelmTemplateCmdOptions) Execute(ctx context.Context) ([]byte, error) {
+// the flags of 'helm template' which only affect the rendered manifests and are not needed to render NOTES.txt.
+// --kube-version and --api-versions are kept because NOTES.txt may depend on the capabilities.
+var (
+	templateOnlyFlags     = []string{"--output-dir", "--show-only", "-s"}
+	templateOnlyBoolFlags = []string{"--include-crds", "--is-upgrade", "--release-name", "--skip-tests", "--validate"}
+)
+
+// NotesArgs returns the args of 'helm install --dry-run=client' to render NOTES.txt.
+func (o *HelmTemplateCmdOptions) NotesArgs() []string {
+	args := []string{
+		"install", o.ReleaseName, o.Chart, "--dry-run=client", "--output=json",
+	}
+	if o.Namespace != "" {
+		args = append(args, fmt.Sprintf("--namespace=%s", o.Namespace))
+	}
+	if o.ValuesFile != "" {
+		args = append(args, fmt.Sprintf("--values=%s", o.ValuesFile))
+	}
+	if o.KubeVersion != "" {
+		args = append(args, fmt.Sprintf("--kube-version=%s", o.KubeVersion))
+	}
+	for _, v := range o.APIVersions {
+		args = append(args, fmt.Sprintf("--api-versions=%s", v))
+	}
+	return append(args, filterTemplateOnlyFlags(o.AdditionalArgs)...)
+}
+
+// filterTemplateOnlyFlags removes the template-only flags and their values from args.
+func filterTemplateOnlyFlags(args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(args[i], "=")
+		switch {
+		case slices.Contains(templateOnlyBoolFlags, name):
+		case slices.Contains(templateOnlyFlags, name):
+			if !hasValue {
+				i++ // skip the value in the next arg
+			}
+		default:
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
+
+func (o *HelmTemplateCmdOptions) Execute(ctx context.Context) (*RenderOutput, error) {
+	// testSpec is not passed to helm
+	valuesFile, cleanup, err := sanitizeValuesFile(o.ValuesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	ht := *o
+	ht.ValuesFile = valuesFile
+
+	out, err := ht.execute(ctx)
+	restoreValuesFilePath(out, valuesFile, o.ValuesFile)
+	if err != nil && valuesFile != o.ValuesFile && strings.Contains(err.Error(), valuesFile) {
+		err = errors.New(strings.ReplaceAll(err.Error(), valuesFile, o.ValuesFile))
+	}
+	return out, err
+}
+
+func (o *HelmTemplateCmdOptions) execute(ctx context.Context) (*RenderOutput, error) {
 	args := o.Args()
 	log().DebugContext(ctx, "executing 'helm template' command", "args", args, "additionalArgs", o.AdditionalArgs)
 
@@ -40,6 +117,47 @@ func (o *HelmTemplateCmdOptions) Execute(ctx context.Context) ([]byte, error) {
 	os.Setenv("HELM_DEBUG", "false")
 
 	cmd := exec.CommandContext(ctx, o.HelmPath, args...)
-	out, err := cmd.CombinedOutput()
-	return out, err
+	out, err := runCommand(cmd)
+	if err != nil || !o.RenderNotes {
+		return out, err
+	}
+
+	notes, err := o.executeNotes(ctx)
+	if err != nil {
+		out.Stderr = append(out.Stderr, []byte(err.Error())...)
+		out.ExitCode = 1
+		return out, fmt.Errorf("failed to render NOTES.txt: %w", err)
+	}
+	out.Notes = notes
+	return out, nil
+}
+
+// executeNotes renders NOTES.txt by 'helm install --dry-run=client'.
+func (o *HelmTemplateCmdOptions) executeNotes(ctx context.Context) (string, error) {
+	args := o.NotesArgs()
+	log().DebugContext(ctx, "executing 'helm install --dry-run=client' command to render NOTES.txt", "args", args)
+
+	cmd := exec.CommandContext(ctx, o.HelmPath, args...)
+	out, err := runCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, out.Stderr)
+	}
+
+	release := struct {
+		Info struct {
+			Notes string `json:"notes"`
+		} `json:"info"`
+	}{}
+	if err := json.Unmarshal(out.Stdout, &release); err != nil {
+		return "", fmt.Errorf("failed to decode release: %w", err)
+	}
+	return release.Info.Notes, nil
+}
+
+func (o *HelmTemplateCmdOptions) Name() string {
+	return "'helm template' command"
+}
+
+func (o *HelmTemplateCmdOptions) Render(ctx context.Context) (*RenderOutput, error) {
+	return o.Execute(ctx)
 }
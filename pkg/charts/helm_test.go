@@ -21,7 +21,7 @@ var _ = Describe("Helm", func() {
 
 			out, err := o.Execute(context.Background())
 			Expect(err).NotTo(HaveOccurred())
-			Expect(out).To(MatchSnapShot())
+			Expect(out.Stdout).To(MatchSnapShot())
 		})
 	})
 
@@ -36,7 +36,7 @@ var _ = Describe("Helm", func() {
 
 			out, err := o.Execute(context.Background())
 			Expect(err).NotTo(HaveOccurred())
-			Expect(out).To(MatchSnapShot())
+			Expect(out.Stdout).To(MatchSnapShot())
 		})
 	})
 
@@ -51,7 +51,7 @@ var _ = Describe("Helm", func() {
 
 			out, err := o.Execute(context.Background())
 			Expect(err).NotTo(HaveOccurred())
-			Expect(out).To(MatchSnapShot())
+			Expect(out.Stdout).To(MatchSnapShot())
 		})
 	})
 
@@ -68,7 +68,86 @@ var _ = Describe("Helm", func() {
 
 			out, err := o.Execute(context.Background())
 			Expect(err).NotTo(HaveOccurred())
-			Expect(out).To(MatchSnapShot())
+			Expect(out.Stdout).To(MatchSnapShot())
+		})
+	})
+
+	Context("when Execute with kube version and api versions", func() {
+		It("should execute with expected args and env", func() {
+			o := &HelmTemplateCmdOptions{
+				HelmPath:    "./testdata/helm_cmd.bash",
+				ReleaseName: "chartsnap",
+				Namespace:   "default",
+				Chart:       "charts/app1/",
+				KubeVersion: "1.25",
+				APIVersions: []string{"policy/v1", "monitoring.coreos.com/v1"},
+			}
+
+			out, err := o.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.Stdout).To(MatchSnapShot())
+		})
+	})
+
+	Context("when Execute with stderr", func() {
+		It("should capture stdout and stderr separately", func() {
+			o := &HelmTemplateCmdOptions{
+				HelmPath:    "./testdata/helm_stderr.bash",
+				ReleaseName: "chartsnap",
+				Chart:       "charts/app1/",
+			}
+
+			out, err := o.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.ExitCode).To(Equal(0))
+			Expect(out.Stdout).To(MatchSnapShot())
+			Expect(out.Stderr).To(MatchSnapShot())
+		})
+
+		It("should record exit code", func() {
+			o := &HelmTemplateCmdOptions{
+				HelmPath:    "./testdata/helm_error.bash",
+				ReleaseName: "chartsnap",
+				Chart:       "charts/app1/",
+			}
+
+			out, err := o.Execute(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(out.ExitCode).To(Equal(1))
+			Expect(out.Stdout).To(BeEmpty())
+			Expect(out.Stderr).To(MatchSnapShot())
+		})
+	})
+
+	Context("when Execute with render notes", func() {
+		It("should render NOTES.txt by helm install with the capabilities and without template-only flags", func() {
+			o := &HelmTemplateCmdOptions{
+				HelmPath:       "./testdata/helm_notes.bash",
+				ReleaseName:    "chartsnap",
+				Namespace:      "default",
+				Chart:          "charts/app1/",
+				ValuesFile:     "charts/app1/test/test.values.yaml",
+				KubeVersion:    "1.25",
+				APIVersions:    []string{"monitoring.coreos.com/v1"},
+				AdditionalArgs: []string{"--skip-tests", "--show-only", "templates/job.yaml", "--api-versions=policy/v1", "--set", "replicaCount=2"},
+				RenderNotes:    true,
+			}
+
+			out, err := o.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.Notes).To(MatchSnapShot())
+		})
+
+		It("should not render NOTES.txt if not enabled", func() {
+			o := &HelmTemplateCmdOptions{
+				HelmPath:    "./testdata/helm_notes.bash",
+				ReleaseName: "chartsnap",
+				Chart:       "charts/app1/",
+			}
+
+			out, err := o.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.Notes).To(BeEmpty())
 		})
 	})
 
@@ -81,7 +160,7 @@ var _ = Describe("Helm", func() {
 			}
 			out, err := o.Execute(context.Background())
 			Expect(err).NotTo(HaveOccurred())
-			Expect(out).To(MatchSnapShot())
+			Expect(out.Stdout).To(MatchSnapShot())
 		})
 	})
 })
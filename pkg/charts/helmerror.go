@@ -0,0 +1,93 @@
+package charts
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+// The messages can span multiple lines. e.g. fail "line1\nline2"
+var (
+	// e.g. execution error at (app1/templates/secret.yaml:8:13): apiKey is required
+	helmExecutionErrorRegexp = regexp.MustCompile(`(?s)^execution error at \((\S+?):(\d+):(\d+)\): (.*)$`)
+	// e.g. template: app1/templates/x.yaml:12:5: executing "app1/templates/x.yaml" at <.Values.a.b>: nil pointer evaluating interface {}.b
+	// The errors in the included templates are nested. The innermost one is the cause.
+	helmExecutingErrorRegexp = regexp.MustCompile(`template: (\S+?):(\d+):(\d+): executing "[^"]*" at <(.*?)>: `)
+	// e.g. parse error at (app1/templates/x.yaml:5): function "foo" not defined
+	helmParseErrorRegexp = regexp.MustCompile(`(?s)^parse error at \((\S+?):(\d+)\): (.*)$`)
+	// e.g. YAML parse error on app1/templates/x.yaml: error converting YAML to JSON: yaml: line 5: did not find expected key
+	helmYAMLErrorRegexp = regexp.MustCompile(`(?s)^YAML parse error on (\S+?): (.*)$`)
+	// e.g. template: app1/templates/x.yaml:3: unexpected "}" in operand
+	helmTemplateErrorRegexp = regexp.MustCompile(`(?s)^template: (\S+?):(\d+)(?::(\d+))?: (.*)$`)
+	// e.g. error calling tpl: ...
+	helmFunctionErrorRegexp = regexp.MustCompile(`(?s)^error calling (\w+): (.*)$`)
+)
+
+// ParseHelmError parses the error of the error output of 'helm template',
+// which starts with 'Error: ' and continues up to the 'Use --debug' trailer or the end of the output.
+// It returns nil if the error output is not in the known formats.
+func ParseHelmError(stderr string) *v1alpha1.HelmError {
+	lines := make([]string, 0)
+	for _, l := range strings.Split(stderr, "\n") {
+		if len(lines) == 0 {
+			if msg, ok := strings.CutPrefix(strings.TrimSpace(l), "Error: "); ok {
+				lines = append(lines, msg)
+			}
+			continue
+		}
+		if strings.HasPrefix(l, "Use --debug") {
+			break
+		}
+		lines = append(lines, l)
+	}
+	line := strings.TrimRightFunc(strings.Join(lines, "\n"), unicode.IsSpace)
+	if line == "" {
+		return nil
+	}
+
+	if m := helmExecutionErrorRegexp.FindStringSubmatch(line); m != nil {
+		return &v1alpha1.HelmError{Template: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Message: m[4]}
+	}
+	if locs := helmExecutingErrorRegexp.FindAllStringSubmatchIndex(line, -1); len(locs) > 0 {
+		loc := locs[len(locs)-1]
+		e := &v1alpha1.HelmError{Template: line[loc[2]:loc[3]], Line: atoi(line[loc[4]:loc[5]]), Column: atoi(line[loc[6]:loc[7]]), Message: line[loc[1]:]}
+		if m := helmFunctionErrorRegexp.FindStringSubmatch(e.Message); m != nil {
+			e.Function, e.Message = m[1], m[2]
+		} else if action := line[loc[8]:loc[9]]; action != "" && !strings.ContainsAny(action[:1], ".$(") {
+			// the function of the failed action. e.g. <required "x" .Values.x>
+			e.Function, _, _ = strings.Cut(action, " ")
+		}
+		return e
+	}
+	if m := helmParseErrorRegexp.FindStringSubmatch(line); m != nil {
+		return &v1alpha1.HelmError{Template: m[1], Line: atoi(m[2]), Message: m[3]}
+	}
+	if m := helmYAMLErrorRegexp.FindStringSubmatch(line); m != nil {
+		return &v1alpha1.HelmError{Template: m[1], Message: m[2]}
+	}
+	if m := helmTemplateErrorRegexp.FindStringSubmatch(line); m != nil {
+		return &v1alpha1.HelmError{Template: m[1], Line: atoi(m[2]), Column: atoi(m[3]), Message: m[4]}
+	}
+	return nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// helmErrorMessage returns the error with the template path in the local chart directory,
+// so that the position is clickable in terminals and editors. e.g. example/app1/templates/secret.yaml:8:13: apiKey is required
+func helmErrorMessage(chart string, e *v1alpha1.HelmError) string {
+	_, rel, ok := strings.Cut(e.Template, "/")
+	if !ok || !IsLocalChart(chart) {
+		return e.Error()
+	}
+	local := *e
+	local.Template = filepath.ToSlash(filepath.Join(chart, rel))
+	return local.Error()
+}
@@ -0,0 +1,90 @@
+package charts
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+func TestParseHelmError(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   *v1alpha1.HelmError
+	}{
+		{
+			name:   "required",
+			stderr: "Error: execution error at (app1/templates/secret.yaml:8:13): apiKey is required\n\nUse --debug flag to render out invalid YAML\n",
+			want:   &v1alpha1.HelmError{Template: "app1/templates/secret.yaml", Line: 8, Column: 13, Message: "apiKey is required"},
+		},
+		{
+			name:   "nil pointer",
+			stderr: `Error: template: app1/templates/deployment.yaml:12:5: executing "app1/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/deployment.yaml", Line: 12, Column: 5, Message: "nil pointer evaluating interface {}.tag"},
+		},
+		{
+			name:   "function",
+			stderr: `Error: template: app1/templates/configmap.yaml:6:10: executing "app1/templates/configmap.yaml" at <tpl .Values.config .>: error calling tpl: cannot retrieve Template.Basepath from values inside tpl function`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/configmap.yaml", Line: 6, Column: 10, Function: "tpl", Message: "cannot retrieve Template.Basepath from values inside tpl function"},
+		},
+		{
+			name:   "function of the action",
+			stderr: `Error: template: app1/templates/configmap.yaml:6:10: executing "app1/templates/configmap.yaml" at <toYaml .Values.config>: wrong number of args for toYaml: want 1 got 0`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/configmap.yaml", Line: 6, Column: 10, Function: "toYaml", Message: "wrong number of args for toYaml: want 1 got 0"},
+		},
+		{
+			name:   "included template",
+			stderr: `Error: template: app1/templates/deployment.yaml:7:8: executing "app1/templates/deployment.yaml" at <include "app1.labels" .>: error calling include: template: app1/templates/_helpers.tpl:40:14: executing "app1.labels" at <.Values.labels.app>: nil pointer evaluating interface {}.app`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/_helpers.tpl", Line: 40, Column: 14, Message: "nil pointer evaluating interface {}.app"},
+		},
+		{
+			name:   "parse error",
+			stderr: `Error: parse error at (app1/templates/service.yaml:5): function "foo" not defined`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/service.yaml", Line: 5, Message: `function "foo" not defined`},
+		},
+		{
+			name:   "YAML parse error",
+			stderr: "Error: YAML parse error on app1/templates/service.yaml: error converting YAML to JSON: yaml: line 5: did not find expected key\n\nUse --debug flag to render out invalid YAML",
+			want:   &v1alpha1.HelmError{Template: "app1/templates/service.yaml", Message: "error converting YAML to JSON: yaml: line 5: did not find expected key"},
+		},
+		{
+			name:   "template error",
+			stderr: `Error: template: app1/templates/service.yaml:3: unexpected "}" in operand`,
+			want:   &v1alpha1.HelmError{Template: "app1/templates/service.yaml", Line: 3, Message: `unexpected "}" in operand`},
+		},
+		{
+			name:   "warnings before the error",
+			stderr: "walk.go:74: found symbolic link in path\nError: execution error at (app1/templates/secret.yaml:8:13): apiKey is required",
+			want:   &v1alpha1.HelmError{Template: "app1/templates/secret.yaml", Line: 8, Column: 13, Message: "apiKey is required"},
+		},
+		{
+			name:   "multi-line message",
+			stderr: "Error: execution error at (app1/templates/secret.yaml:8:13): apiKey is required\nset one of:\n  - apiKey\n  - existingSecret\n\nUse --debug flag to render out invalid YAML\n",
+			want:   &v1alpha1.HelmError{Template: "app1/templates/secret.yaml", Line: 8, Column: 13, Message: "apiKey is required\nset one of:\n  - apiKey\n  - existingSecret"},
+		},
+		{
+			name:   "multi-line message of the function",
+			stderr: "Error: template: app1/templates/configmap.yaml:6:10: executing \"app1/templates/configmap.yaml\" at <fail \"x\">: error calling fail: first\nsecond",
+			want:   &v1alpha1.HelmError{Template: "app1/templates/configmap.yaml", Line: 6, Column: 10, Function: "fail", Message: "first\nsecond"},
+		},
+		{
+			name:   "unknown format",
+			stderr: "Error: INSTALLATION FAILED: chart requires kubeVersion: >=1.25.0",
+			want:   nil,
+		},
+		{
+			name:   "no error line",
+			stderr: "connection refused",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, ParseHelmError(tt.stderr)); diff != "" {
+				t.Errorf("ParseHelmError() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package charts
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// UnknownValuesKeys returns the dot-separated keys of the test values file which do not exist
+// in the default values of the chart, e.g. a misspelled 'ingres.enabled'.
+// testSpec, global, the values of the dependencies and the allowed keys are skipped.
+// The children of the keys whose default value is not a non-empty mapping are free-form and not checked, e.g. 'podAnnotations: {}'.
+func UnknownValuesKeys(chart, valuesFile string, allowed []string) ([]string, error) {
+	b, err := readChartFile(chart, "values.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values.yaml of the chart: %w", err)
+	}
+	defaults, err := parseValues(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values.yaml of the chart: %w", err)
+	}
+
+	b, err = os.ReadFile(valuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %w", err)
+	}
+	values, err := parseValues(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values file '%s': %w", valuesFile, err)
+	}
+
+	skipped := map[string]bool{testSpecKey: true, "global": true}
+	if b, err := readChartFile(chart, "Chart.yaml"); err == nil {
+		var deps chartDependencies
+		if err := yaml.Unmarshal(b, &deps); err != nil {
+			return nil, fmt.Errorf("failed to decode Chart.yaml: %w", err)
+		}
+		for _, d := range deps.Dependencies {
+			// the values of the dependency are passed by the alias if set
+			if d.Alias != "" {
+				skipped[d.Alias] = true
+			} else {
+				skipped[d.Name] = true
+			}
+		}
+	}
+
+	unknown := make([]string, 0)
+	var walk func(keys []string, n, def *kyaml.Node)
+	walk = func(keys []string, n, def *kyaml.Node) {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := append(append([]string{}, keys...), n.Content[i].Value)
+			if (len(keys) == 0 && skipped[k[0]]) || isAllowedKey(k, allowed) {
+				continue
+			}
+			d := mappingValue(def, n.Content[i].Value)
+			if d == nil {
+				unknown = append(unknown, strings.Join(k, "."))
+				continue
+			}
+			if v := n.Content[i+1]; v.Kind == kyaml.MappingNode && d.Kind == kyaml.MappingNode && len(d.Content) > 0 {
+				walk(k, v, d)
+			}
+		}
+	}
+	if values.Kind == kyaml.MappingNode {
+		walk(nil, values, defaults)
+	}
+	return unknown, nil
+}
+
+// parseValues returns the top mapping node of the values. An empty values file is an empty mapping.
+func parseValues(b []byte) (*kyaml.Node, error) {
+	if len(strings.TrimSpace(string(b))) == 0 {
+		return &kyaml.Node{Kind: kyaml.MappingNode}, nil
+	}
+	node, err := kyaml.Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+	return node.YNode(), nil
+}
+
+func mappingValue(n *kyaml.Node, key string) *kyaml.Node {
+	if n == nil || n.Kind != kyaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// isAllowedKey returns true if the key or its parent matches any of the allowed keys.
+func isAllowedKey(key []string, allowed []string) bool {
+ALLOWED:
+	for _, a := range allowed {
+		segments := strings.Split(a, ".")
+		if len(segments) > len(key) {
+			continue
+		}
+		for i, s := range segments {
+			if ok, _ := path.Match(s, key[i]); !ok {
+				continue ALLOWED
+			}
+		}
+		return true
+	}
+	return false
+}
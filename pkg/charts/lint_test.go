@@ -0,0 +1,69 @@
+package charts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnknownValuesKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  string
+		allowed []string
+		want    []string
+	}{
+		{
+			name:   "known keys",
+			values: "replicaCount: 2\nimage:\n  tag: latest\ningress:\n  enabled: true\n  hosts: []\n",
+			want:   []string{},
+		},
+		{
+			name:   "misspelled keys",
+			values: "ingres:\n  enabled: true\nimage:\n  tags: latest\n",
+			want:   []string{"ingres", "image.tags"},
+		},
+		{
+			name:   "free-form values",
+			values: "podAnnotations:\n  foo: bar\nresources:\n  limits:\n    cpu: 100m\ningress:\n  hosts:\n    - host: example.com\n      paths: []\n",
+			want:   []string{},
+		},
+		{
+			name:   "testSpec, global and dependencies",
+			values: "testSpec:\n  snapshotStderr: true\nglobal:\n  imageRegistry: example.com\npostgresql:\n  auth: {}\nbackend:\n  replicaCount: 2\napp1:\n  replicaCount: 2\n",
+			want:   []string{"app1"},
+		},
+		{
+			name:    "allowed keys",
+			values:  "extraEnv:\n  FOO: bar\nimage:\n  digest: sha256\n  pullSecret: secret\n",
+			allowed: []string{"extraEnv", "image.*"},
+			want:    []string{},
+		},
+		{
+			name:   "empty values",
+			values: "",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+			if err := os.WriteFile(valuesFile, []byte(tt.values), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := UnknownValuesKeys("testdata/lint", valuesFile, tt.allowed)
+			if err != nil {
+				t.Fatalf("UnknownValuesKeys() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("UnknownValuesKeys() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if _, err := UnknownValuesKeys("testdata/not-found", "testdata/snap_values.yaml", nil); err == nil {
+		t.Errorf("UnknownValuesKeys() expected error for the chart not found")
+	}
+}
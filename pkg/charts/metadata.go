@@ -0,0 +1,215 @@
+package charts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ChartMetadata is the metadata in Chart.yaml
+type ChartMetadata struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+}
+
+// ReadChartMetadata reads Chart.yaml of the chart directory or the chart archive.
+func ReadChartMetadata(chart string) (*ChartMetadata, error) {
+	b, err := readChartFile(chart, "Chart.yaml")
+	if err != nil {
+		return nil, err
+	}
+	return decodeChartMetadata(b)
+}
+
+func decodeChartMetadata(b []byte) (*ChartMetadata, error) {
+	var meta ChartMetadata
+	if err := yaml.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("failed to decode Chart.yaml: %w", err)
+	}
+	return &meta, nil
+}
+
+// readChartFile reads the file in the top directory of the chart directory or the chart archive. e.g. Chart.yaml
+func readChartFile(chart, name string) ([]byte, error) {
+	stat, err := os.Stat(chart)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return os.ReadFile(filepath.Join(chart, name))
+	}
+	return readChartArchiveFile(chart, name)
+}
+
+// readChartArchiveFile reads the file in the top directory of the chart archive.
+func readChartArchiveFile(file, name string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s not found in chart archive %s", name, file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart archive: %w", err)
+		}
+		if dir, base := path.Split(h.Name); base == name && strings.Count(dir, "/") == 1 {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// readChartCRDs reads the files in the crds directories of the chart and its subcharts in the chart directory or the chart archive.
+// The subcharts are read from the charts directory whether they are unpacked or archived.
+// It returns the contents keyed by the path in the chart like 'crds/widget.yaml' or 'charts/sub/crds/widget.yaml'.
+func readChartCRDs(chart string) (map[string][]byte, error) {
+	crds := make(map[string][]byte)
+	err := walkChartFiles(chart, isCRDFile, func(name string, data []byte) error {
+		crds[name] = data
+		return nil
+	})
+	return crds, err
+}
+
+// isCRDFile returns true if the file is in the crds directory of the chart or its subcharts like 'charts/sub/crds/widget.yaml'.
+func isCRDFile(name string) bool {
+	for strings.HasPrefix(name, "charts/") {
+		_, rest, ok := strings.Cut(strings.TrimPrefix(name, "charts/"), "/")
+		if !ok {
+			return false
+		}
+		name = rest
+	}
+	if !strings.HasPrefix(name, "crds/") {
+		return false
+	}
+	switch path.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// isSubchartArchive returns true if the file is a subchart archive in the charts directory like 'charts/sub-0.1.0.tgz'.
+func isSubchartArchive(name string) bool {
+	dir, base := path.Split(name)
+	return path.Base(dir) == "charts" && path.Ext(base) == ".tgz"
+}
+
+// walkChartFiles calls fn with the path in the chart and the contents of the files matching in the chart directory or the chart archive.
+// The subchart archives in the charts directory are walked as the directories like 'charts/sub/...'.
+func walkChartFiles(chart string, match func(name string) bool, fn func(name string, data []byte) error) error {
+	stat, err := os.Stat(chart)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		f, err := os.Open(chart)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return walkChartArchive(f, "", match, fn)
+	}
+
+	return filepath.WalkDir(chart, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(chart, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !match(name) && !isSubchartArchive(name) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if isSubchartArchive(name) {
+			return walkChartArchive(bytes.NewReader(data), path.Dir(name), match, fn)
+		}
+		return fn(name, data)
+	})
+}
+
+// walkChartArchive walks the files in the chart archive.
+// The top directory in the archive is replaced with parent, or removed if parent is empty.
+func walkChartArchive(r io.Reader, parent string, match func(name string) bool, fn func(name string, data []byte) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to read chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read chart archive: %w", err)
+		}
+		if h.Typeflag == tar.TypeDir {
+			continue
+		}
+		name := h.Name
+		if parent == "" {
+			if _, rest, ok := strings.Cut(name, "/"); ok {
+				name = rest
+			}
+		} else {
+			name = parent + "/" + name
+		}
+		if !match(name) && !isSubchartArchive(name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read chart archive: %w", err)
+		}
+		if isSubchartArchive(name) {
+			err = walkChartArchive(bytes.NewReader(data), path.Dir(name), match, fn)
+		} else {
+			err = fn(name, data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HelmVersion returns the version of the helm command like 'v3.15.4'.
+func HelmVersion(ctx context.Context, helmPath string) (string, error) {
+	out, err := runCommand(exec.CommandContext(ctx, helmPath, "version", "--template={{ .Version }}"))
+	if err != nil {
+		return "", fmt.Errorf("'helm version' failed: %w: %s", err, out.Combined())
+	}
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
@@ -0,0 +1,83 @@
+package charts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadChartMetadata(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "app1-0.1.0.tgz")
+	// Chart.yaml of subcharts must be skipped
+	writeChartArchive(t, archive,
+		[2]string{"app1/charts/sub/Chart.yaml", "name: sub\nversion: 9.9.9\n"},
+		[2]string{"app1/Chart.yaml", "apiVersion: v2\nname: app1\nversion: 0.1.0\nappVersion: \"1.16.0\"\n"},
+	)
+
+	tests := []struct {
+		name    string
+		chart   string
+		want    *ChartMetadata
+		wantErr bool
+	}{
+		{
+			name:  "chart directory",
+			chart: "../../example/app1",
+			want:  &ChartMetadata{Name: "app1", Version: "0.1.0", AppVersion: "1.16.0"},
+		},
+		{
+			name:  "chart archive",
+			chart: archive,
+			want:  &ChartMetadata{Name: "app1", Version: "0.1.0", AppVersion: "1.16.0"},
+		},
+		{
+			name:    "remote chart",
+			chart:   "oci://ghcr.io/nginxinc/charts/nginx-gateway-fabric",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadChartMetadata(tt.chart)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadChartMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ReadChartMetadata() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func writeChartArchive(t interface {
+	Helper()
+	Fatal(args ...any)
+}, file string, files ...[2]string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		name, body := f[0], f[1]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
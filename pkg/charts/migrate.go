@@ -0,0 +1,221 @@
+package charts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	goyaml "sigs.k8s.io/yaml/goyaml.v3"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/snap"
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+// MigratedSnapshot is a snapshot file converted into the latest format.
+type MigratedSnapshot struct {
+	// Source is the path of the original snapshot file.
+	Source string
+	// Path is the path of the migrated snapshot file.
+	// It differs from Source if the source is a v1 multi-snapshot file of the other snapshot ID.
+	Path string
+	// FromVersion is the snapshot version of the source.
+	FromVersion string
+	// Data is the migrated snapshot file contents including the header.
+	Data []byte
+	// SemanticallyEqual is true if the manifests are the same as the source except formatting.
+	SemanticallyEqual bool
+}
+
+// Changed returns true if the migrated file is different from the source file.
+func (m *MigratedSnapshot) Changed() bool {
+	if m.Path != m.Source {
+		return true
+	}
+	raw, err := snap.ReadFile(m.Source)
+	return err != nil || !bytes.Equal(raw, m.Data)
+}
+
+// MigrateSnapshot converts the v1 or v2 snapshot file into the given version without rendering the chart again.
+// It returns nothing if the snapshot file is already in the version.
+// The header is written with the snapshot version of toVersion and the version of the source as migrated_from.
+//
+// The sources have neither the '# Source:' comments nor the key order of the templates,
+// so the manifests are written in the migrated form, which has no comments and the keys sorted.
+// The v3 snapshot matches the rendered manifests in the same form while the header has migrated_from.
+func MigrateSnapshot(file, toVersion string, header v1alpha1.Header) ([]*MigratedSnapshot, error) {
+	if toVersion != SnapshotVersionV3 {
+		return nil, fmt.Errorf("unsupported snapshot version '%s'. only %s is supported", toVersion, SnapshotVersionV3)
+	}
+	header.SnapshotVersion = toVersion
+	header.MigratedFrom = ""
+
+	raw, err := snap.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+
+	if snaps, err := snap.DecodeMultiSnapshots(raw); err == nil {
+		ids := make([]string, 0, len(snaps))
+		for id := range snaps {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		out := make([]*MigratedSnapshot, 0, len(snaps))
+		for _, id := range ids {
+			s, ok := snaps[id].Snapshot.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid v1 snapshot '%s'", id)
+			}
+			m, err := migrateV1(s, header)
+			if err != nil {
+				return nil, fmt.Errorf("failed to migrate v1 snapshot '%s': %w", id, err)
+			}
+			m.Source, m.Path = file, filepath.Join(filepath.Dir(file), id+filepath.Ext(file))
+			out = append(out, m)
+		}
+		return out, nil
+	}
+
+	first, _, _ := strings.Cut(string(raw), "\n")
+	if v1alpha1.IsHeader(first) {
+		if v := v1alpha1.ParseHeader(first).SnapshotVersion; v == toVersion {
+			return nil, nil
+		} else if v != SnapshotVersionV2 {
+			return nil, fmt.Errorf("unsupported snapshot version '%s'", v)
+		}
+	}
+
+	m, err := migrateV2(raw, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate v2 snapshot: %w", err)
+	}
+	m.Source, m.Path = file, file
+	return []*MigratedSnapshot{m}, nil
+}
+
+// migrateV1 converts the list of legacy formatted objects like '- object: {...}'.
+func migrateV1(s string, header v1alpha1.Header) (*MigratedSnapshot, error) {
+	list, err := kyaml.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := list.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make([]*kyaml.RNode, 0, len(elements))
+	source := make([]any, 0, len(elements))
+	for _, e := range elements {
+		obj := e.Field("object")
+		if obj == nil {
+			return nil, fmt.Errorf("object field not found in v1 snapshot")
+		}
+		manifests = append(manifests, obj.Value)
+
+		var v any
+		if err := obj.Value.YNode().Decode(&v); err != nil {
+			return nil, err
+		}
+		source = append(source, v)
+	}
+	return migrate(SnapshotVersionV1, source, manifests, header)
+}
+
+func migrateV2(raw []byte, header v1alpha1.Header) (*MigratedSnapshot, error) {
+	source, err := decodeDocuments(raw)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := yaml.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+	return migrate(SnapshotVersionV2, source, manifests, header)
+}
+
+func migrate(from string, source []any, manifests []*kyaml.RNode, header v1alpha1.Header) (*MigratedSnapshot, error) {
+	data, err := encodeMigrated(from)(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifests: %w", err)
+	}
+	migrated, err := decodeDocuments(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode migrated manifests: %w", err)
+	}
+	header.MigratedFrom = from
+	return &MigratedSnapshot{
+		FromVersion:       from,
+		Data:              append([]byte(header.ToString()), data...),
+		SemanticallyEqual: reflect.DeepEqual(source, migrated),
+	}, nil
+}
+
+// encodeMigrated returns the function to encode the manifests in the form migrated from the version.
+// The comments and the styles like quotes and flow style are removed and the keys are sorted, which the sources of the migration do not keep.
+// The manifests migrated from v1 are also sorted by apiVersion, kind and name in the same order as v1.
+func encodeMigrated(from string) func([]*kyaml.RNode) ([]byte, error) {
+	return func(manifests []*kyaml.RNode) ([]byte, error) {
+		for _, m := range manifests {
+			normalizeMigratedNode(m.YNode())
+		}
+		if from == SnapshotVersionV1 {
+			sort.SliceStable(manifests, func(i, j int) bool {
+				x, y := manifests[i], manifests[j]
+				if x.GetApiVersion() != y.GetApiVersion() {
+					return x.GetApiVersion() < y.GetApiVersion()
+				}
+				if x.GetKind() != y.GetKind() {
+					return x.GetKind() < y.GetKind()
+				}
+				return x.GetName() < y.GetName()
+			})
+		}
+		return yaml.Encode(manifests)
+	}
+}
+
+func normalizeMigratedNode(n *kyaml.Node) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+	n.Style = 0
+	if n.Kind == kyaml.MappingNode {
+		pairs := make([][2]*kyaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*kyaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0].Value < pairs[j][0].Value })
+		for i, p := range pairs {
+			n.Content[2*i], n.Content[2*i+1] = p[0], p[1]
+		}
+	}
+	for _, c := range n.Content {
+		normalizeMigratedNode(c)
+	}
+}
+
+// decodeDocuments decodes multi-document YAML into generic values to compare them semantically.
+func decodeDocuments(data []byte) ([]any, error) {
+	docs := make([]any, 0)
+	dec := goyaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			docs = append(docs, v)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package charts
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/snap"
+)
+
+var _ = Describe("MigrateSnapshot", func() {
+	header := v1alpha1.Header{ChartsnapVersion: "v0.5.0"}
+
+	It("should migrate v1 snapshot", func() {
+		migrated, err := MigrateSnapshot("../../example/app1/test_v1/__snapshots__/test_hpa_enabled.snap", SnapshotVersionV3, header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(HaveLen(1))
+		Expect(migrated[0].FromVersion).To(Equal(SnapshotVersionV1))
+		Expect(migrated[0].Path).To(Equal(migrated[0].Source))
+		Expect(migrated[0].SemanticallyEqual).To(BeTrue())
+		Expect(migrated[0].Changed()).To(BeTrue())
+		Expect(migrated[0].Data).To(MatchSnapShot())
+	})
+
+	It("should migrate v1 multi-snapshot into the files of each snapshot ID", func() {
+		migrated, err := MigrateSnapshot("testdata/migrate_v1_multi.snap", SnapshotVersionV3, header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(HaveLen(2))
+		Expect(migrated[0].Path).To(Equal("testdata/test_a.snap"))
+		Expect(migrated[1].Path).To(Equal("testdata/test_b.snap"))
+		for _, m := range migrated {
+			Expect(m.SemanticallyEqual).To(BeTrue())
+			Expect(m.Data).To(MatchSnapShot())
+		}
+	})
+
+	It("should migrate v2 snapshot", func() {
+		migrated, err := MigrateSnapshot("../../example/app1/test_v2/__snapshots__/test_hpa_enabled.snap", SnapshotVersionV3, header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(HaveLen(1))
+		Expect(migrated[0].FromVersion).To(Equal(SnapshotVersionV2))
+		Expect(migrated[0].SemanticallyEqual).To(BeTrue())
+		Expect(migrated[0].Data).To(MatchSnapShot())
+	})
+
+	It("should do nothing for v3 snapshot", func() {
+		migrated, err := MigrateSnapshot("../../example/app1/test_v3/__snapshots__/test_hpa_enabled.snap", SnapshotVersionV3, header)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeEmpty())
+	})
+
+	It("should fail for unsupported version", func() {
+		_, err := MigrateSnapshot("../../example/app1/test_v2/__snapshots__/test_hpa_enabled.snap", SnapshotVersionV2, header)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should fail if the multi-snapshot is not a chartsnap snapshot", func() {
+		_, err := MigrateSnapshot("__snapshots__/helm_test.snap", SnapshotVersionV3, header)
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("should match the migrated snapshot with the rendered manifests",
+		func(from string) {
+			for _, name := range []string{"test_certmanager_enabled.snap", "test_hpa_enabled.snap", "test_ingress_enabled.snap"} {
+				migrated, err := MigrateSnapshot(filepath.Join("../../example/app1/test_"+from, "__snapshots__", name), SnapshotVersionV3, header)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(migrated).To(HaveLen(1))
+				file := filepath.Join(GinkgoT().TempDir(), "__snapshots__", name)
+				Expect(snap.WriteFile(file, migrated[0].Data)).To(Succeed())
+
+				// the manifests rendered in v3 format have the '# Source:' comments and the key order of the templates
+				rendered, err := os.ReadFile(filepath.Join("../../example/app1/test_v3/__snapshots__", name))
+				Expect(err).NotTo(HaveOccurred())
+				s := &ChartSnapshotter{
+					Renderer:     &ReaderRenderer{Reader: bytes.NewReader(rendered), Source: "test"},
+					SnapshotFile: file,
+				}
+				result, err := s.Snap(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Match).To(BeTrue(), result.FailureMessage)
+
+				s = &ChartSnapshotter{
+					Renderer:     &ReaderRenderer{Reader: strings.NewReader(strings.Replace(string(rendered), "name: chartsnap-app1\n", "name: changed\n", 1)), Source: "test"},
+					SnapshotFile: file,
+				}
+				result, err = s.Snap(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.Match).To(BeFalse())
+				Expect(result.FailureMessage).To(ContainSubstring("name: changed"))
+			}
+		},
+		Entry("v1", SnapshotVersionV1),
+		Entry("v2", SnapshotVersionV2),
+	)
+})
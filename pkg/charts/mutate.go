@@ -0,0 +1,336 @@
+package charts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Mutation operators applied to the chart templates.
+const (
+	MutationNegateIf       = "negate-if"
+	MutationDropWith       = "drop-with"
+	MutationChangeDefault  = "change-default"
+	MutationRemoveTemplate = "remove-template"
+)
+
+var (
+	templateActionRegexp = regexp.MustCompile(`(?s)\{\{-?\s*(.*?)\s*-?\}\}`)
+	ifActionRegexp       = regexp.MustCompile(`(?s)^((?:else\s+)?if)\s+(.+)$`)
+	withActionRegexp     = regexp.MustCompile(`(?s)^(with\s+(?:\$\w+\s*:=\s*)?)(.+)$`)
+	defaultLiteralRegexp = regexp.MustCompile(`\bdefault\s+("(?:[^"\\]|\\.)*"|-?\d+(?:\.\d+)?|true|false)`)
+)
+
+// Mutant is a chart with a single mutation applied to a template.
+type Mutant struct {
+	// Template is the path of the mutated template in the chart. e.g. templates/deployment.yaml
+	Template string `json:"template"`
+	// Line is the line of the mutated action. 0 if the template is removed.
+	Line int `json:"line"`
+	// Operator is the mutation operator. negate-if, drop-with, change-default or remove-template.
+	Operator string `json:"operator"`
+	// Original is the action before the mutation.
+	Original string `json:"original,omitempty"`
+	// Mutated is the action after the mutation.
+	Mutated string `json:"mutated,omitempty"`
+
+	// content is the mutated template. nil if the template is removed.
+	content []byte
+}
+
+// String returns the location and the mutation. e.g. templates/hpa.yaml:1 negate-if: {{ if .Values.hpa }} -> {{ if not (.Values.hpa) }}
+func (m Mutant) String() string {
+	if m.Operator == MutationRemoveTemplate {
+		return fmt.Sprintf("%s %s", m.Template, m.Operator)
+	}
+	return fmt.Sprintf("%s:%d %s: %s -> %s", m.Template, m.Line, m.Operator, m.Original, m.Mutated)
+}
+
+// Apply writes the mutated template into the copy of the chart.
+func (m Mutant) Apply(chart string) error {
+	p := filepath.Join(chart, filepath.FromSlash(m.Template))
+	if m.content == nil {
+		return os.Remove(p)
+	}
+	return os.WriteFile(p, m.content, 0644)
+}
+
+// Mutants returns the mutants of the templates of the chart directory in the order of the file names and the lines.
+// The actions in all the files under the templates directory are mutated,
+// and the templates except partials and NOTES.txt are removed one by one. The subcharts are not mutated.
+func Mutants(chart string) ([]Mutant, error) {
+	if !IsLocalChart(chart) {
+		return nil, fmt.Errorf("mutation testing requires a chart directory: %s", chart)
+	}
+	files := make([]string, 0)
+	dir := filepath.Join(chart, "templates")
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(chart, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read chart templates: %w", err)
+	}
+	sort.Strings(files)
+
+	mutants := make([]Mutant, 0)
+	for _, f := range files {
+		b, err := os.ReadFile(filepath.Join(chart, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart template: %w", err)
+		}
+		mutants = append(mutants, actionMutants(f, b)...)
+		if isTemplate(f) {
+			mutants = append(mutants, Mutant{Template: f, Operator: MutationRemoveTemplate})
+		}
+	}
+	return mutants, nil
+}
+
+// actionMutants returns the mutants of the template actions in the content.
+func actionMutants(template string, content []byte) []Mutant {
+	mutants := make([]Mutant, 0)
+	add := func(operator string, start, end int, original, mutated string) {
+		c := make([]byte, 0, len(content)-(end-start)+len(mutated))
+		c = append(append(append(c, content[:start]...), mutated...), content[end:]...)
+		mutants = append(mutants, Mutant{
+			Template: template,
+			Line:     1 + strings.Count(string(content[:start]), "\n"),
+			Operator: operator,
+			Original: firstLine(original),
+			Mutated:  firstLine(mutated),
+			content:  c,
+		})
+	}
+
+	for _, loc := range templateActionRegexp.FindAllSubmatchIndex(content, -1) {
+		action := string(content[loc[0]:loc[1]])
+		bodyStart, bodyEnd := loc[2], loc[3]
+		body := string(content[bodyStart:bodyEnd])
+		replaceBody := func(b string) string {
+			return action[:bodyStart-loc[0]] + b + action[bodyEnd-loc[0]:]
+		}
+
+		if m := ifActionRegexp.FindStringSubmatch(body); m != nil {
+			add(MutationNegateIf, loc[0], loc[1], action, replaceBody(fmt.Sprintf("%s not (%s)", m[1], m[2])))
+		}
+		if m := withActionRegexp.FindStringSubmatch(body); m != nil {
+			add(MutationDropWith, loc[0], loc[1], action, replaceBody(m[1]+"false"))
+		}
+		for _, d := range defaultLiteralRegexp.FindAllStringSubmatchIndex(body, -1) {
+			literal := body[d[2]:d[3]]
+			add(MutationChangeDefault, loc[0], loc[1], action, replaceBody(body[:d[2]]+mutateLiteral(literal)+body[d[3]:]))
+		}
+	}
+	return mutants
+}
+
+// mutateLiteral returns a literal different from the string, number or boolean literal.
+func mutateLiteral(literal string) string {
+	switch {
+	case literal == "true":
+		return "false"
+	case literal == "false":
+		return "true"
+	case literal == `""`:
+		return `"chartsnap-mutated"`
+	case strings.HasPrefix(literal, `"`):
+		return strings.TrimSuffix(literal, `"`) + `-chartsnap-mutated"`
+	}
+	if n, err := strconv.Atoi(literal); err == nil {
+		return strconv.Itoa(n + 1)
+	}
+	if f, err := strconv.ParseFloat(literal, 64); err == nil {
+		return strconv.FormatFloat(f+0.5, 'f', -1, 64)
+	}
+	return literal
+}
+
+// MutationTester applies the mutants to copies of the chart one at a time
+// and runs the snapshot tests to find the mutants which no test case detects.
+type MutationTester struct {
+	// Chart is the chart directory to mutate.
+	Chart string
+	// Snapshotters are the test cases matching the existing snapshots.
+	// Their chart is replaced with the mutated copy and the snapshots are never updated.
+	Snapshotters []ChartSnapshotter
+	// Parallelism is the number of the mutants tested in parallel. Unlimited if negative.
+	Parallelism int
+}
+
+// MutationReport is the result of the mutation testing.
+type MutationReport struct {
+	Total    int            `json:"total"`
+	Killed   int            `json:"killed"`
+	Survived int            `json:"survived"`
+	Score    float64        `json:"score"`
+	Mutants  []MutantResult `json:"mutants"`
+}
+
+// MutantResult is the result of a mutant.
+type MutantResult struct {
+	Mutant
+	// Killed is true if any test case did not match the snapshot.
+	Killed bool `json:"killed"`
+	// KilledBy is the first test case which detected the mutant.
+	KilledBy string `json:"killedBy,omitempty"`
+}
+
+// Run checks that the snapshots match without mutations and tests each mutant of the chart.
+func (t *MutationTester) Run(ctx context.Context) (*MutationReport, error) {
+	for _, s := range t.Snapshotters {
+		if _, err := os.Stat(s.SnapshotFile); os.IsNotExist(err) {
+			return nil, fmt.Errorf("snapshot of %s not found. take the snapshots before mutation testing", s.testCase())
+		}
+		if killed, err := t.snap(ctx, s, t.Chart); err != nil {
+			return nil, err
+		} else if killed {
+			return nil, fmt.Errorf("snapshot of %s does not match without mutations. update the snapshots before mutation testing", s.testCase())
+		}
+	}
+
+	mutants, err := Mutants(t.Chart)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MutationReport{Total: len(mutants), Score: 100, Mutants: make([]MutantResult, len(mutants))}
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(t.Parallelism)
+	for i, m := range mutants {
+		r := &report.Mutants[i]
+		r.Mutant = m
+		eg.Go(func() error {
+			dir, err := os.MkdirTemp("", "chartsnap-mutant-*")
+			if err != nil {
+				return fmt.Errorf("failed to create mutant directory: %w", err)
+			}
+			defer os.RemoveAll(dir)
+
+			chart := filepath.Join(dir, filepath.Base(t.Chart))
+			if err := copyDir(t.Chart, chart); err != nil {
+				return fmt.Errorf("failed to copy chart: %w", err)
+			}
+			if err := m.Apply(chart); err != nil {
+				return fmt.Errorf("failed to apply mutant %s: %w", m, err)
+			}
+			for _, s := range t.Snapshotters {
+				killed, err := t.snap(ctx, s, chart)
+				if err != nil {
+					// a mutant breaking the rendering is detected
+					log().Debug("snapshot of mutant failed", "mutant", m.String(), "testCase", s.testCase(), "err", err)
+					killed = true
+				}
+				if killed {
+					r.Killed, r.KilledBy = true, s.testCase()
+					return nil
+				}
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range report.Mutants {
+		if r.Killed {
+			report.Killed++
+		} else {
+			report.Survived++
+		}
+	}
+	if report.Total > 0 {
+		report.Score = float64(report.Killed) * 100 / float64(report.Total)
+	}
+	return report, nil
+}
+
+// snap matches the snapshot of the test case rendered with the chart and returns true if it does not match.
+func (t *MutationTester) snap(ctx context.Context, s ChartSnapshotter, chart string) (bool, error) {
+	s.HelmTemplateCmdOptions.Chart = chart
+	s.UpdateSnapshot = false
+	s.Coverage = nil
+	result, err := s.Snap(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !result.Match, nil
+}
+
+// copyDir copies the files of the directory recursively.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(p, target)
+	})
+}
+
+// Format returns the report in the text or JSON format.
+func (r *MutationReport) Format(format string) (string, error) {
+	switch format {
+	case CoverageFormatText:
+		return r.String(), nil
+	case CoverageFormatJSON:
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode mutation report: %w", err)
+		}
+		return string(b) + "\n", nil
+	default:
+		return "", fmt.Errorf("unsupported mutation report format '%s'", format)
+	}
+}
+
+// String returns the survived mutants in the text format.
+func (r *MutationReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Mutants: %d, killed: %d, survived: %d, mutation score: %.1f%%\n", r.Total, r.Killed, r.Survived, r.Score)
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	for _, m := range r.Mutants {
+		if m.Killed {
+			continue
+		}
+		location := m.Template
+		if m.Line > 0 {
+			location = fmt.Sprintf("%s:%d", m.Template, m.Line)
+		}
+		change := ""
+		if m.Original != "" {
+			change = fmt.Sprintf("%s -> %s", m.Original, m.Mutated)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", location, m.Operator, change)
+	}
+	tw.Flush()
+	return sb.String()
+}
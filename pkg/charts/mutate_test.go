@@ -0,0 +1,101 @@
+package charts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMutateLiteral(t *testing.T) {
+	tests := []struct {
+		literal string
+		want    string
+	}{
+		{literal: "true", want: "false"},
+		{literal: "false", want: "true"},
+		{literal: `""`, want: `"chartsnap-mutated"`},
+		{literal: `"info"`, want: `"info-chartsnap-mutated"`},
+		{literal: "1", want: "2"},
+		{literal: "-1", want: "0"},
+		{literal: "0.5", want: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.literal, func(t *testing.T) {
+			if got := mutateLiteral(tt.literal); got != tt.want {
+				t.Errorf("mutateLiteral() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionMutants(t *testing.T) {
+	template := `{{- if and .Values.a .Values.b }}
+{{- with $x := .Values.c -}}
+{{ .Values.d | default "x" }} {{ default 3 .Values.e }}
+{{/* if not mutated */}}
+{{- else if .Values.f }}
+{{- end }}
+{{- end }}
+`
+	want := []string{
+		`templates/t.yaml:1 negate-if: {{- if and .Values.a .Values.b }} -> {{- if not (and .Values.a .Values.b) }}`,
+		`templates/t.yaml:2 drop-with: {{- with $x := .Values.c -}} -> {{- with $x := false -}}`,
+		`templates/t.yaml:3 change-default: {{ .Values.d | default "x" }} -> {{ .Values.d | default "x-chartsnap-mutated" }}`,
+		`templates/t.yaml:3 change-default: {{ default 3 .Values.e }} -> {{ default 4 .Values.e }}`,
+		`templates/t.yaml:5 negate-if: {{- else if .Values.f }} -> {{- else if not (.Values.f) }}`,
+	}
+	got := make([]string, 0)
+	for _, m := range actionMutants("templates/t.yaml", []byte(template)) {
+		got = append(got, m.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("actionMutants() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+var _ = Describe("MutationTester", func() {
+	var tester MutationTester
+	BeforeEach(func() {
+		s := ChartSnapshotter{
+			HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+				HelmPath:    "./testdata/helm_mutate.bash",
+				ReleaseName: "chartsnap",
+				Chart:       "testdata/mutate",
+			},
+			SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "default.snap"),
+			SnapshotVersion: SnapshotVersionLatest,
+		}
+		tester = MutationTester{Chart: "testdata/mutate", Snapshotters: []ChartSnapshotter{s}, Parallelism: -1}
+	})
+
+	It("should report the mutants which no test case detects", func() {
+		s := tester.Snapshotters[0]
+		s.UpdateSnapshot = true
+		_, err := s.Snap(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := tester.Run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.String()).To(MatchSnapShot())
+		Expect(report.Killed).To(Equal(5))
+
+		// the chart is not mutated
+		Expect(os.ReadFile("testdata/mutate/templates/configmap.yaml")).To(ContainSubstring(`default "info"`))
+	})
+
+	It("should return error if the snapshot is not taken", func() {
+		_, err := tester.Run(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("take the snapshots before mutation testing")))
+	})
+
+	It("should return error for a remote chart", func() {
+		_, err := Mutants("oci://ghcr.io/jlandowner/charts/app1")
+		Expect(err).To(MatchError(ContainSubstring("mutation testing requires a chart directory")))
+	})
+})
@@ -0,0 +1,163 @@
+package charts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+// Renderer renders the manifests of a test case to be snapshotted.
+type Renderer interface {
+	// Name returns a description of the renderer used in messages.
+	Name() string
+	// Render returns the rendered manifests.
+	Render(ctx context.Context) (*RenderOutput, error)
+}
+
+// RenderOutput is the output of a renderer.
+// Stdout and Stderr are captured separately not to mix warnings into the manifests.
+type RenderOutput struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+	// Notes is the rendered NOTES.txt if the renderer supports it.
+	Notes string
+}
+
+// Combined returns stderr followed by stdout like the combined output of the command.
+// It is used for the error messages. The snapshots use the stderr filtered by ignoreStderrPatterns instead.
+func (o *RenderOutput) Combined() []byte {
+	out := make([]byte, 0, len(o.Stderr)+len(o.Stdout))
+	out = append(out, o.Stderr...)
+	return append(out, o.Stdout...)
+}
+
+// runCommand executes the command and captures stdout, stderr and exit code.
+func runCommand(cmd *exec.Cmd) (*RenderOutput, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	out := &RenderOutput{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		out.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		out.ExitCode = -1
+	}
+	return out, err
+}
+
+// isHelmRenderer returns true if the renderer config renders the chart by 'helm template' command.
+func isHelmRenderer(cfg *v1alpha1.RendererConfig) bool {
+	return cfg == nil || (cfg.File == "" && len(cfg.Command) == 0)
+}
+
+// NewRenderer returns a Renderer for the renderer config.
+// File paths and command args in the config are expanded as Go templates with the helm template options.
+// e.g. "{{ .Chart }}", "{{ .ValuesFile }}", "{{ .ReleaseName }}" and "{{ .Namespace }}"
+// If the config is nil or empty, 'helm template' command is used.
+func NewRenderer(cfg *v1alpha1.RendererConfig, ht HelmTemplateCmdOptions) (Renderer, error) {
+	switch {
+	case isHelmRenderer(cfg):
+		return &ht, nil
+
+	case cfg.File != "" && len(cfg.Command) > 0:
+		return nil, fmt.Errorf("renderer config must have either file or command")
+
+	case cfg.File != "":
+		f, err := expandTemplate(cfg.File, ht)
+		if err != nil {
+			return nil, err
+		}
+		return &FileRenderer{Path: f}, nil
+
+	default:
+		command := make([]string, len(cfg.Command))
+		for i, v := range cfg.Command {
+			c, err := expandTemplate(v, ht)
+			if err != nil {
+				return nil, err
+			}
+			command[i] = c
+		}
+		return &CommandRenderer{Command: command}, nil
+	}
+}
+
+func expandTemplate(text string, ht HelmTemplateCmdOptions) (string, error) {
+	tmpl, err := template.New("renderer").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse renderer config '%s': %w", text, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ht); err != nil {
+		return "", fmt.Errorf("failed to expand renderer config '%s': %w", text, err)
+	}
+	return buf.String(), nil
+}
+
+// FileRenderer renders the manifests from a pre-rendered file.
+type FileRenderer struct {
+	Path string
+}
+
+func (r *FileRenderer) Name() string {
+	return fmt.Sprintf("pre-rendered file '%s'", r.Path)
+}
+
+func (r *FileRenderer) Render(ctx context.Context) (*RenderOutput, error) {
+	log().DebugContext(ctx, "reading pre-rendered file", "path", r.Path)
+	out, err := os.ReadFile(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderOutput{Stdout: out}, nil
+}
+
+// CommandRenderer renders the manifests by any command like 'kustomize build --enable-helm'.
+type CommandRenderer struct {
+	Command []string
+}
+
+func (r *CommandRenderer) Name() string {
+	return fmt.Sprintf("'%s' command", strings.Join(r.Command, " "))
+}
+
+func (r *CommandRenderer) Render(ctx context.Context) (*RenderOutput, error) {
+	if len(r.Command) == 0 {
+		return nil, fmt.Errorf("command is empty")
+	}
+	log().DebugContext(ctx, "executing render command", "command", r.Command)
+
+	cmd := exec.CommandContext(ctx, r.Command[0], r.Command[1:]...)
+	return runCommand(cmd)
+}
+
+// ReaderRenderer renders the manifests read from the reader like stdin.
+type ReaderRenderer struct {
+	Reader io.Reader
+	Source string
+}
+
+func (r *ReaderRenderer) Name() string {
+	return r.Source
+}
+
+func (r *ReaderRenderer) Render(ctx context.Context) (*RenderOutput, error) {
+	log().DebugContext(ctx, "reading manifests", "source", r.Source)
+	out, err := io.ReadAll(r.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderOutput{Stdout: out}, nil
+}
@@ -0,0 +1,83 @@
+package charts
+
+import (
+	"context"
+
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+var _ = Describe("Renderer", func() {
+	ht := HelmTemplateCmdOptions{
+		HelmPath:    "./testdata/helm_cmd.bash",
+		ReleaseName: "chartsnap",
+		Namespace:   "default",
+		Chart:       "charts/app1/",
+		ValuesFile:  "./testdata/rendered.yaml",
+	}
+
+	Context("NewRenderer", func() {
+		It("should return helm template renderer if config is nil", func() {
+			r, err := NewRenderer(nil, ht)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(BeAssignableToTypeOf(&HelmTemplateCmdOptions{}))
+			Expect(r.Name()).To(Equal("'helm template' command"))
+		})
+
+		It("should return file renderer with expanded path", func() {
+			r, err := NewRenderer(&v1alpha1.RendererConfig{File: "{{ .ValuesFile }}"}, ht)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(&FileRenderer{Path: "./testdata/rendered.yaml"}))
+		})
+
+		It("should return command renderer with expanded args", func() {
+			r, err := NewRenderer(&v1alpha1.RendererConfig{Command: []string{"kustomize", "build", "--enable-helm", "{{ .Chart }}", "--namespace={{ .Namespace }}"}}, ht)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r).To(Equal(&CommandRenderer{Command: []string{"kustomize", "build", "--enable-helm", "charts/app1/", "--namespace=default"}}))
+			Expect(r.Name()).To(Equal("'kustomize build --enable-helm charts/app1/ --namespace=default' command"))
+		})
+
+		It("should fail if both file and command are specified", func() {
+			_, err := NewRenderer(&v1alpha1.RendererConfig{File: "a.yaml", Command: []string{"cat", "a.yaml"}}, ht)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should fail if template is invalid", func() {
+			_, err := NewRenderer(&v1alpha1.RendererConfig{File: "{{ .NotFound }}"}, ht)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("FileRenderer", func() {
+		It("should render file contents", func() {
+			r := &FileRenderer{Path: "./testdata/rendered.yaml"}
+			out, err := r.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.Stdout).To(MatchSnapShot())
+		})
+
+		It("should fail if file not found", func() {
+			r := &FileRenderer{Path: "./testdata/notfound.yaml"}
+			_, err := r.Render(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("CommandRenderer", func() {
+		It("should render command output", func() {
+			r := &CommandRenderer{Command: []string{"cat", "./testdata/rendered.yaml"}}
+			out, err := r.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out.Stdout).To(MatchSnapShot())
+		})
+
+		It("should fail if command is empty", func() {
+			r := &CommandRenderer{}
+			_, err := r.Render(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
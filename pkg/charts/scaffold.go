@@ -0,0 +1,242 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+	goyaml "sigs.k8s.io/yaml/goyaml.v3"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	pkgyaml "github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+// the last keys of the boolean values regarded as feature toggles.
+var toggleKeys = []string{"enabled", "create", "tls"}
+
+// FeatureToggle is a boolean value in the chart's values.yaml which switches a feature. e.g. ingress.enabled
+type FeatureToggle struct {
+	Path    []string
+	Default bool
+}
+
+// Key returns the dot-separated key of the toggle.
+func (t FeatureToggle) Key() string {
+	return strings.Join(t.Path, ".")
+}
+
+// FileName returns the name of the test values file flipping the toggle.
+// e.g. test_ingress_enabled.yaml for ingress.enabled=false, test_serviceaccount_create_disabled.yaml for serviceAccount.create=true
+func (t FeatureToggle) FileName() string {
+	p := t.Path
+	if p[len(p)-1] == "enabled" {
+		p = p[:len(p)-1]
+	}
+	state := "enabled"
+	if t.Default {
+		state = "disabled"
+	}
+	return strings.ToLower(fmt.Sprintf("test_%s_%s.yaml", strings.Join(p, "_"), state))
+}
+
+// ScaffoldFile is a file generated by the scaffold.
+type ScaffoldFile struct {
+	Name    string
+	Content []byte
+}
+
+// FeatureToggles returns the feature toggles in the values.yaml of the chart directory or the chart archive
+// in the order of the document.
+func FeatureToggles(chart string) ([]FeatureToggle, error) {
+	b, err := readChartFile(chart, "values.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values.yaml of the chart: %w", err)
+	}
+	leaves, err := valuesLeaves(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode values.yaml of the chart: %w", err)
+	}
+	toggles := make([]FeatureToggle, 0)
+	for _, l := range leaves {
+		if l.node.Kind != kyaml.ScalarNode || l.node.ShortTag() != kyaml.NodeTagBool || !slices.Contains(toggleKeys, l.path[len(l.path)-1]) {
+			continue
+		}
+		var v bool
+		if err := l.node.Decode(&v); err != nil {
+			return nil, fmt.Errorf("failed to decode '%s': %w", l.key(), err)
+		}
+		toggles = append(toggles, FeatureToggle{Path: l.path, Default: v})
+	}
+	return toggles, nil
+}
+
+// ScaffoldValuesFiles returns a test values file flipping each toggle and the all-features-on file.
+// The 'enabled' toggles of the parents are turned on together so that the flipped toggle takes effect.
+// e.g. certManager.enabled=true is set with certManager.issuer.create=false
+func ScaffoldValuesFiles(toggles []FeatureToggle) ([]ScaffoldFile, error) {
+	files := make([]ScaffoldFile, 0, len(toggles)+1)
+	all := make([]FeatureToggle, 0)
+	for _, t := range toggles {
+		set := []FeatureToggle{{Path: t.Path, Default: !t.Default}}
+		for _, p := range toggles {
+			if parent := p.Path[:len(p.Path)-1]; p.Path[len(p.Path)-1] == "enabled" && !p.Default &&
+				p.Key() != t.Key() && len(parent) < len(t.Path) && slices.Equal(parent, t.Path[:len(parent)]) {
+				set = append(set, FeatureToggle{Path: p.Path, Default: true})
+			}
+		}
+		f, err := scaffoldValuesFile(t.FileName(), set)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+
+		if !t.Default {
+			all = append(all, FeatureToggle{Path: t.Path, Default: true})
+		}
+	}
+	if len(all) > 1 {
+		f, err := scaffoldValuesFile("test_all_enabled.yaml", all)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// scaffoldValuesFile returns the values file setting the toggles to their Default.
+func scaffoldValuesFile(name string, set []FeatureToggle) (ScaffoldFile, error) {
+	values := make(map[string]any)
+	keys := make([]string, 0, len(set))
+	for _, t := range set {
+		m := values
+		for _, k := range t.Path[:len(t.Path)-1] {
+			child, ok := m[k].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				m[k] = child
+			}
+			m = child
+		}
+		m[t.Path[len(t.Path)-1]] = t.Default
+		keys = append(keys, fmt.Sprintf("%s=%t", t.Key(), t.Default))
+	}
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return ScaffoldFile{}, fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	header := fmt.Sprintf("# generated by chartsnap scaffold: %s\n", strings.Join(keys, ", "))
+	return ScaffoldFile{Name: name, Content: append([]byte(header), b...)}, nil
+}
+
+// DetectDynamicFields compares the manifests rendered twice with the same values
+// and returns the fields whose values differ as the dynamic fields. The data of Secrets are base64-encoded.
+func DetectDynamicFields(x, y []byte) ([]v1alpha1.ManifestPath, error) {
+	xs, err := pkgyaml.Decode(x)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifests: %w", err)
+	}
+	ys, err := pkgyaml.Decode(y)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifests: %w", err)
+	}
+
+	fields := make([]v1alpha1.ManifestPath, 0)
+	for _, xm := range xs {
+		i := slices.IndexFunc(ys, func(ym *kyaml.RNode) bool {
+			return ym.GetApiVersion() == xm.GetApiVersion() && ym.GetKind() == xm.GetKind() && ym.GetName() == xm.GetName()
+		})
+		if i < 0 || xm.GetKind() == "" {
+			continue
+		}
+		paths := make([]string, 0)
+		diffPaths(xm.YNode(), ys[i].YNode(), "", &paths)
+		if len(paths) == 0 {
+			continue
+		}
+		f := v1alpha1.ManifestPath{APIVersion: xm.GetApiVersion(), Kind: xm.GetKind(), Name: xm.GetName(), JSONPath: paths}
+		if f.Kind == "Secret" && !slices.ContainsFunc(paths, func(p string) bool { return !strings.HasPrefix(p, "/data/") }) {
+			f.Base64 = true
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// diffPaths appends the JSON pointers of the fields whose values differ between x and y.
+func diffPaths(x, y *kyaml.Node, path string, paths *[]string) {
+	if x.Kind != y.Kind {
+		*paths = append(*paths, path)
+		return
+	}
+	switch x.Kind {
+	case kyaml.MappingNode:
+		for i := 0; i+1 < len(x.Content); i += 2 {
+			if v := mappingValue(y, x.Content[i].Value); v != nil {
+				diffPaths(x.Content[i+1], v, path+"/"+escapeJSONPointer(x.Content[i].Value), paths)
+			}
+		}
+	case kyaml.SequenceNode:
+		if len(x.Content) != len(y.Content) {
+			*paths = append(*paths, path)
+			return
+		}
+		for i := range x.Content {
+			diffPaths(x.Content[i], y.Content[i], fmt.Sprintf("%s/%d", path, i), paths)
+		}
+	default:
+		if x.Value != y.Value {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+// escapeJSONPointer escapes the reference token of JSON pointer by RFC6901.
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// MergeDynamicFields merges the JSON paths of the same resources. The order of the resources is kept.
+func MergeDynamicFields(fields ...v1alpha1.ManifestPath) []v1alpha1.ManifestPath {
+	merged := make([]v1alpha1.ManifestPath, 0, len(fields))
+	for _, f := range fields {
+		i := slices.IndexFunc(merged, func(m v1alpha1.ManifestPath) bool {
+			return m.APIVersion == f.APIVersion && m.Kind == f.Kind && m.Name == f.Name
+		})
+		if i < 0 {
+			f.JSONPath = slices.Clone(f.JSONPath)
+			merged = append(merged, f)
+			continue
+		}
+		for _, p := range f.JSONPath {
+			if !slices.Contains(merged[i].JSONPath, p) {
+				merged[i].JSONPath = append(merged[i].JSONPath, p)
+			}
+		}
+		merged[i].Base64 = merged[i].Base64 && f.Base64
+	}
+	return merged
+}
+
+// ScaffoldConfig returns the starter config file with the dynamic fields.
+func ScaffoldConfig(fields []v1alpha1.ManifestPath) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# This file defines common behavior of the chart snapshots in the test directory.\n")
+	buf.WriteString("# generated by chartsnap scaffold. dynamicFields are detected by rendering each test case twice.\n")
+	if len(fields) == 0 {
+		buf.WriteString("dynamicFields: []\n")
+		return buf.Bytes(), nil
+	}
+	enc := goyaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v1alpha1.SnapshotConfig{DynamicFields: fields}); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,126 @@
+package charts
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+func TestFeatureToggle_FileName(t *testing.T) {
+	tests := []struct {
+		toggle FeatureToggle
+		want   string
+	}{
+		{toggle: FeatureToggle{Path: []string{"ingress", "enabled"}}, want: "test_ingress_enabled.yaml"},
+		{toggle: FeatureToggle{Path: []string{"certManager", "enabled"}}, want: "test_certmanager_enabled.yaml"},
+		{toggle: FeatureToggle{Path: []string{"serviceAccount", "create"}, Default: true}, want: "test_serviceaccount_create_disabled.yaml"},
+		{toggle: FeatureToggle{Path: []string{"tls"}}, want: "test_tls_enabled.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.toggle.FileName(); got != tt.want {
+				t.Errorf("FileName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectDynamicFields(t *testing.T) {
+	x := []byte(`---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: cert
+data:
+  tls.crt: Zmlyc3Q=
+  tls.key: Zmlyc3Q=
+  ca.crt: Y2E=
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    checksum/config: "1111"
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          args: [--token=aaa]
+`)
+	y := []byte(`---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: cert
+data:
+  tls.crt: c2Vjb25k
+  tls.key: c2Vjb25k
+  ca.crt: Y2E=
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    checksum/config: "2222"
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          args: [--token=bbb]
+`)
+	want := []v1alpha1.ManifestPath{
+		{APIVersion: "v1", Kind: "Secret", Name: "cert", JSONPath: []string{"/data/tls.crt", "/data/tls.key"}, Base64: true},
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", JSONPath: []string{"/metadata/annotations/checksum~1config", "/spec/template/spec/containers/0/args/0"}},
+	}
+	got, err := DetectDynamicFields(x, y)
+	if err != nil {
+		t.Fatalf("DetectDynamicFields() error = %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DetectDynamicFields() mismatch (-want +got):\n%s", diff)
+	}
+
+	merged := MergeDynamicFields(append(got, v1alpha1.ManifestPath{APIVersion: "v1", Kind: "Secret", Name: "cert", JSONPath: []string{"/data/ca.crt", "/data/tls.crt"}, Base64: true})...)
+	if diff := cmp.Diff([]string{"/data/tls.crt", "/data/tls.key", "/data/ca.crt"}, merged[0].JSONPath); diff != "" {
+		t.Errorf("MergeDynamicFields() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+var _ = Describe("Scaffold", func() {
+	It("should generate test values files from the feature toggles", func() {
+		toggles, err := FeatureToggles("../../example/app1")
+		Expect(err).NotTo(HaveOccurred())
+		keys := make([]string, 0)
+		for _, t := range toggles {
+			keys = append(keys, t.Key())
+		}
+		Expect(keys).To(Equal([]string{"serviceAccount.create", "ingress.enabled", "certManager.enabled", "certManager.issuer.create", "autoscaling.enabled"}))
+
+		files, err := ScaffoldValuesFiles(toggles)
+		Expect(err).NotTo(HaveOccurred())
+		for _, f := range files {
+			Expect(string(f.Content)).To(MatchSnapShot(), f.Name)
+		}
+	})
+
+	It("should generate the config file with the dynamic fields", func() {
+		b, err := ScaffoldConfig([]v1alpha1.ManifestPath{
+			{APIVersion: "v1", Kind: "Secret", Name: "cert", JSONPath: []string{"/data/tls.crt"}, Base64: true},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(MatchSnapShot())
+
+		b, err = ScaffoldConfig(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(MatchSnapShot())
+	})
+})
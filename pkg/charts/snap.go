@@ -6,10 +6,15 @@ import (
 	"log/slog"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+
 	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/schema"
 	"github.com/jlandowner/helm-chartsnap/pkg/snap"
 	unstV2 "github.com/jlandowner/helm-chartsnap/pkg/unstructured"
 	unstV1 "github.com/jlandowner/helm-chartsnap/pkg/unstructured/v1"
@@ -23,6 +28,25 @@ const (
 	SnapshotVersionLatest = SnapshotVersionV3
 )
 
+// Actions when the chart version in the snapshot header differs from the rendered chart.
+const (
+	ChartVersionMismatchIgnore = "ignore"
+	ChartVersionMismatchWarn   = "warn"
+	ChartVersionMismatchFail   = "fail"
+)
+
+// Actions when the rendered resources use deprecated or removed APIs in the target Kubernetes version.
+const (
+	DeprecatedAPIWarn = "warn"
+	DeprecatedAPIFail = "fail"
+)
+
+// Actions when the rendered resources have the same API group, kind, namespace and name.
+const (
+	DuplicateResourceWarn = "warn"
+	DuplicateResourceFail = "fail"
+)
+
 var (
 	logger *slog.Logger
 	mutex  sync.Mutex
@@ -45,13 +69,41 @@ func log() *slog.Logger {
 
 type ChartSnapshotter struct {
 	HelmTemplateCmdOptions HelmTemplateCmdOptions
-	SnapshotConfig         v1alpha1.SnapshotConfig
-	SnapshotFile           string
-	SnapshotVersion        string
-	DiffContextLineN       int
-	UpdateSnapshot         bool
-	HeaderVersion          string
-	FailHelmError          bool
+	// Renderer renders manifests instead of HelmTemplateCmdOptions if set.
+	// If not set, the renderer config in the snapshot config or 'helm template' command is used.
+	Renderer         Renderer
+	SnapshotConfig   v1alpha1.SnapshotConfig
+	SnapshotFile     string
+	SnapshotVersion  string
+	DiffContextLineN int
+	UpdateSnapshot   bool
+	HeaderVersion    string
+	FailHelmError    bool
+	// HelmVersion is the version of the helm command written in the snapshot header.
+	HelmVersion string
+	// ChartVersionMismatch is the action when the chart version in the snapshot header differs from the rendered chart.
+	// ignore, warn or fail. The check is skipped if empty, while the chartsnap command defaults to warn.
+	ChartVersionMismatch string
+	// ValidateSchema validates the rendered resources against the Kubernetes schemas before matching snapshots.
+	ValidateSchema bool
+	// SchemaDirs are the directories of the JSON schemas in the kubeconform layout used by the schema validation.
+	SchemaDirs []string
+	// ValidateCRDs validates the custom resources against the schemas of the CustomResourceDefinitions before matching snapshots.
+	ValidateCRDs bool
+	// CRDDirs are the directories of the CustomResourceDefinitions used by the CRD validation,
+	// in addition to the 'crds' directory of the local chart and the CRDs in the rendered manifests.
+	CRDDirs []string
+	// ValidateReferences checks the references between the rendered resources before matching snapshots.
+	ValidateReferences bool
+	// TargetKubeVersion is the Kubernetes version to check the rendered resources for deprecated or removed APIs.
+	// The check is disabled if empty.
+	TargetKubeVersion string
+	// DeprecatedAPI is the action when deprecated or removed APIs are found. warn or fail. Default is warn.
+	DeprecatedAPI string
+	// DuplicateResource is the action when resources of the same identity are rendered. warn or fail. Default is warn.
+	DuplicateResource string
+	// Coverage records the templates rendered in the test case if set.
+	Coverage *TemplateCoverage
 }
 
 type SnapshotResult struct {
@@ -67,20 +119,89 @@ func (o *ChartSnapshotter) updateSnapshot() error {
 	return nil
 }
 
-func (o *ChartSnapshotter) prependSnapshotHeader(data []byte) []byte {
-	header := (&v1alpha1.Header{SnapshotVersion: o.SnapshotVersion}).ToString()
-	data = append([]byte(header), data...)
+// Header returns the snapshot header with the metadata of the chart and tools.
+func (o *ChartSnapshotter) Header() *v1alpha1.Header {
+	ht := o.HelmTemplateCmdOptions
+	h := &v1alpha1.Header{
+		SnapshotVersion:  o.SnapshotVersion,
+		HelmVersion:      o.HelmVersion,
+		ChartsnapVersion: o.HeaderVersion,
+		ReleaseName:      ht.ReleaseName,
+		Namespace:        ht.Namespace,
+	}
+	if ht.Chart != "" {
+		if meta, err := ReadChartMetadata(ht.Chart); err == nil {
+			h.Chart, h.ChartVersion, h.AppVersion = meta.Name, meta.Version, meta.AppVersion
+		} else {
+			log().Debug("failed to read chart metadata", "chart", ht.Chart, "err", err)
+		}
+	}
+	return h
+}
+
+func (o *ChartSnapshotter) prependSnapshotHeader(header *v1alpha1.Header, data []byte) []byte {
+	data = append([]byte(header.ToString()), data...)
 	return data
 }
 
-func (o *ChartSnapshotter) getVersionFromSnapshotFile() string {
+// readSnapshotHeader returns the header of the snapshot file. It returns nil if the file does not exist.
+func (o *ChartSnapshotter) readSnapshotHeader() *v1alpha1.Header {
 	s, err := snap.ReadFile(o.SnapshotFile)
 	if err != nil {
 		log().Debug("failed to read snapshot file", "path", o.SnapshotFile, "err", err)
-		return SnapshotVersionLatest
+		return nil
 	}
 	split := strings.Split(string(s), "\n")
-	return v1alpha1.ParseHeader(split[0]).SnapshotVersion
+	return v1alpha1.ParseHeader(split[0])
+}
+
+func (o *ChartSnapshotter) getVersionFromSnapshotFile() string {
+	h := o.readSnapshotHeader()
+	if h == nil {
+		return SnapshotVersionLatest
+	}
+	return h.SnapshotVersion
+}
+
+// checkChartVersion compares the chart version in the existing snapshot header with the rendered chart.
+// It returns a failure message if the versions differ and the action is fail.
+func (o *ChartSnapshotter) checkChartVersion(header *v1alpha1.Header) string {
+	if o.ChartVersionMismatch == "" || o.ChartVersionMismatch == ChartVersionMismatchIgnore {
+		return ""
+	}
+	old := o.readSnapshotHeader()
+	if old == nil || old.ChartVersion == "" || header.ChartVersion == "" || old.ChartVersion == header.ChartVersion {
+		return ""
+	}
+
+	msg := fmt.Sprintf("chart version in the snapshot is %s but the rendered chart is %s. update the snapshot with --update-snapshot", old.ChartVersion, header.ChartVersion)
+	if o.ChartVersionMismatch == ChartVersionMismatchFail {
+		return msg
+	}
+	log().Warn(msg, "path", o.SnapshotFile)
+	return ""
+}
+
+// equalIgnoringHeader compares snapshots except the header, so that header-only changes are not mismatches.
+func equalIgnoringHeader(expected, actual string) bool {
+	return trimHeader(expected) == trimHeader(actual)
+}
+
+func trimHeader(s string) string {
+	if first, rest, ok := strings.Cut(s, "\n"); ok && v1alpha1.IsHeader(first) {
+		return rest
+	}
+	return s
+}
+
+// replaceHeader replaces the header of the expected snapshot with the actual one
+// not to show header-only changes in the diff, keeping the line numbers.
+func replaceHeader(expected, actual string) string {
+	first, _, ok := strings.Cut(actual, "\n")
+	if !ok || !v1alpha1.IsHeader(first) || trimHeader(expected) == expected {
+		return expected
+	}
+	return first + "\n" + trimHeader(expected)
 }
 
 func (o *ChartSnapshotter) Snap(ctx context.Context) (result *SnapshotResult, err error) {
@@ -92,27 +213,35 @@ func (o *ChartSnapshotter) Snap(ctx context.Context) (result *SnapshotResult, er
 		log().Error("unexpected error in snapshot file stat", "path", o.SnapshotFile, "err", err)
 	}
 
-	// override snapshot config within values file's test spec
-	sv := v1alpha1.SnapshotValues{}
-	if o.HelmTemplateCmdOptions.ValuesFile != "" {
-		err = v1alpha1.FromFile(o.HelmTemplateCmdOptions.ValuesFile, &sv)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode values file: %w", err)
+	testSpec, out, renderErr, err := o.render(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Coverage != nil {
+		if err := o.Coverage.Add(o.testCase(), out.Stdout); err != nil {
+			log().Warn("failed to record template coverage", "err", err, "path", o.SnapshotFile)
+		}
+		if o.Renderer == nil && isHelmRenderer(testSpec.Renderer) {
+			if err := o.Coverage.AddBranches(ctx, o.testCase(), o.HelmTemplateCmdOptions); err != nil {
+				log().Debug("failed to record branch coverage", "err", err, "path", o.SnapshotFile)
+			}
 		}
 	}
-	log().Debug("loaded values", "values", sv, "path", o.SnapshotFile)
-	sv.TestSpec.Merge(o.SnapshotConfig)
 
-	// execute helm template command
-	out, err := o.HelmTemplateCmdOptions.Execute(ctx)
-	if err != nil {
-		if o.FailHelmError {
-			return nil, fmt.Errorf("'helm template' command failed: %w: %s", err, out)
-		} else {
-			log().Error("helm command failed but snapshot it anyway. use --fail-helm-error if you want error exit code", "err", err, "output", string(out))
+	if testSpec.ExpectError != "" {
+		// the expected error is snapshotted as well as the failed render without expectError
+		if res := o.checkExpectError(testSpec.ExpectError, out, renderErr); res != nil {
+			return res, nil
 		}
+	} else if msg, err := o.checkManifests(testSpec, out); err != nil {
+		return nil, err
+	} else if msg != "" {
+		return &SnapshotResult{
+			Match:          false,
+			FailureMessage: msg,
+		}, nil
 	}
-	log().Debug("helm template output", "output", string(out), "path", o.SnapshotFile)
 
 	// fallback if version is not specified
 	if o.SnapshotVersion == "" {
@@ -141,18 +270,93 @@ func (o *ChartSnapshotter) Snap(ctx context.Context) (result *SnapshotResult, er
 	switch o.SnapshotVersion {
 	case SnapshotVersionV1:
 		log().Warn("legacy format snapshot. it will be deprecated in the future version. please update the snapshots to the latest format", "path", o.SnapshotFile)
-		return o.snapV1(sv.TestSpec, out)
+		data, err := combinedOutput(testSpec, out)
+		if err != nil {
+			return nil, err
+		}
+		return o.snapV1(testSpec, data)
 	case SnapshotVersionV2:
-		return o.snapV2(sv.TestSpec, out)
+		data, err := combinedOutput(testSpec, out)
+		if err != nil {
+			return nil, err
+		}
+		return o.snapV2(testSpec, data)
 	case SnapshotVersionV3:
-		return o.snapV3(sv.TestSpec, out)
+		return o.snapV3(testSpec, out)
 	default:
 		log().Error("unsupported snapshot version. use latest", "version", o.SnapshotVersion, "latest", SnapshotVersionLatest)
 		o.SnapshotVersion = SnapshotVersionLatest
-		return o.snapV3(sv.TestSpec, out)
+		return o.snapV3(testSpec, out)
 	}
 }
 
+// Render renders the manifests and returns them in the latest snapshot format without the header.
+// The dynamic fields are replaced with the fixed values but the snapshot is not matched.
+func (o *ChartSnapshotter) Render(ctx context.Context) ([]byte, error) {
+	testSpec, out, _, err := o.render(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests, err := assembleManifests(testSpec, out)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := yaml.Encode(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifests: %w", err)
+	}
+	return raw, nil
+}
+
+// render renders the manifests by the renderer of the test case.
+// The error of the renderer is returned as renderErr instead of err if expectError is set.
+func (o *ChartSnapshotter) render(ctx context.Context) (testSpec v1alpha1.SnapshotConfig, out *RenderOutput, renderErr, err error) {
+	// override snapshot config within values file's test spec
+	testSpec, err = LoadTestSpec(o.HelmTemplateCmdOptions.ValuesFile, o.SnapshotConfig)
+	if err != nil {
+		return testSpec, nil, nil, err
+	}
+	log().Debug("loaded test spec", "testSpec", testSpec, "path", o.SnapshotFile)
+
+	ht := o.HelmTemplateCmdOptions
+	ht.RenderNotes = ht.RenderNotes || testSpec.RenderNotes
+
+	renderer := o.Renderer
+	if renderer == nil {
+		renderer, err = NewRenderer(testSpec.Renderer, ht)
+		if err != nil {
+			return testSpec, nil, nil, fmt.Errorf("failed to prepare renderer: %w", err)
+		}
+	}
+
+	// execute helm template command or other renderer
+	out, err = renderer.Render(ctx)
+	if out == nil {
+		return testSpec, nil, nil, fmt.Errorf("%s failed: %w", renderer.Name(), err)
+	}
+	if err != nil && testSpec.ExpectError != "" {
+		// the error is checked by expectError
+		log().Debug(fmt.Sprintf("%s failed with expectError", renderer.Name()), "err", err, "expectError", testSpec.ExpectError, "path", o.SnapshotFile)
+		renderErr = err
+	} else if err != nil {
+		if o.FailHelmError {
+			if helmErr := ParseHelmError(string(out.Stderr)); helmErr != nil {
+				return testSpec, nil, nil, fmt.Errorf("%s failed: %w: %s", renderer.Name(), err, helmErrorMessage(ht.Chart, helmErr))
+			}
+			return testSpec, nil, nil, fmt.Errorf("%s failed: %w: %s", renderer.Name(), err, out.Combined())
+		} else {
+			log().Error(fmt.Sprintf("%s failed but snapshot it anyway. use --fail-helm-error if you want error exit code", renderer.Name()), "err", err, "output", string(out.Combined()))
+		}
+	}
+	if _, ok := renderer.(*HelmTemplateCmdOptions); !ok && testSpec.RenderNotes {
+		log().Warn(fmt.Sprintf("renderNotes is not supported by %s. ignored", renderer.Name()))
+	}
+	log().Debug("render output", "renderer", renderer.Name(), "stdout", string(out.Stdout), "stderr", string(out.Stderr), "exitCode", out.ExitCode, "notes", out.Notes, "path", o.SnapshotFile)
+	return testSpec, out, renderErr, nil
+}
+
 func (o *ChartSnapshotter) snapV1(cfg v1alpha1.SnapshotConfig, data []byte) (result *SnapshotResult, err error) {
 	// decode helm output to unstructured
 	manifests, decodeErrs := unstV2.Decode(string(data))
@@ -224,30 +428,41 @@ func (o *ChartSnapshotter) snapV2(cfg v1alpha1.SnapshotConfig, data []byte) (res
 	}, nil
 }
 
-func (o *ChartSnapshotter) snapV3(cfg v1alpha1.SnapshotConfig, data []byte) (result *SnapshotResult, err error) {
+func (o *ChartSnapshotter) snapV3(cfg v1alpha1.SnapshotConfig, out *RenderOutput) (result *SnapshotResult, err error) {
 	snap.SetLogger(log())
-	yaml.SetLogger(log())
 
-	// decode helm output to kustomize/kyaml Nodes
-	manifests, err := yaml.Decode(data)
+	manifests, err := assembleManifests(cfg, out)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode manifests: %w", err)
+		return nil, err
 	}
 
-	// apply fixed values to dynamic fields
-	if err := yaml.ApplyFixedValueToDynamicFieleds(cfg, manifests); err != nil {
-		return nil, fmt.Errorf("failed to replace json path: %w", err)
+	header := o.Header()
+	encode := yaml.Encode
+	if old := o.readSnapshotHeader(); old != nil && old.MigratedFrom != "" {
+		// the migrated snapshot is matched in the migrated form until it is updated
+		header.MigratedFrom = old.MigratedFrom
+		encode = encodeMigrated(old.MigratedFrom)
 	}
 
-	raw, err := yaml.Encode(manifests)
+	raw, err := encode(manifests)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode manifests: %w", err)
 	}
 
-	matcher := snap.SnapshotMatcher(o.SnapshotFile, snap.WithDiffFunc((&yaml.DiffOptions{ContextLineN: o.DiffContextLineN}).Diff))
+	if msg := o.checkChartVersion(header); msg != "" {
+		return &SnapshotResult{
+			Match:          false,
+			FailureMessage: msg,
+		}, nil
+	}
+
+	diff := (&yaml.DiffOptions{ContextLineN: o.DiffContextLineN}).Diff
+	matcher := snap.SnapshotMatcher(o.SnapshotFile,
+		snap.WithDiffFunc(func(x, y string) string { return diff(replaceHeader(x, y), y) }),
+		snap.WithEqualFunc(equalIgnoringHeader))
 
 	// add snapshot header on the top of the snapshot file from v3
-	raw = o.prependSnapshotHeader(raw)
+	raw = o.prependSnapshotHeader(header, raw)
 
 	match, err := matcher.Match(raw)
 	if err != nil {
@@ -259,6 +474,385 @@ func (o *ChartSnapshotter) snapV3(cfg v1alpha1.SnapshotConfig, data []byte) (res
 	}, nil
 }
 
+// testCase returns the name of the test case by the values file and the Kubernetes versions. e.g. test_hpa.yaml@k8s-1.25
+func (o *ChartSnapshotter) testCase() string {
+	ht := o.HelmTemplateCmdOptions
+	name := ht.ValuesFile
+	if name == "" {
+		name = "default"
+	}
+	m := v1alpha1.MatrixEntry{KubeVersion: ht.KubeVersion, APIVersions: ht.APIVersions}
+	if id := m.ID(); id != "" {
+		name += "@" + id
+	}
+	return name
+}
+
+// checkExpectError checks that the render command failed with the expected error.
+// It returns the failure result if not, or nil to take the snapshot of the error.
+func (o *ChartSnapshotter) checkExpectError(expectError string, out *RenderOutput, renderErr error) *SnapshotResult {
+	if out.ExitCode == 0 && renderErr == nil {
+		return &SnapshotResult{
+			Match:          false,
+			FailureMessage: fmt.Sprintf("expected the render to fail with '%s' but it succeeded", expectError),
+		}
+	}
+	errText := expectErrorText(out, renderErr)
+	if !matchesExpectError(expectError, errText) {
+		return &SnapshotResult{
+			Match:          false,
+			FailureMessage: fmt.Sprintf("expected the render to fail with '%s' but it failed with: %s", expectError, errText),
+		}
+	}
+	log().Debug("render failed with the expected error", "expectError", expectError, "path", o.SnapshotFile)
+	return nil
+}
+
+// expectErrorText returns the error of the render command, stderr and stdout joined by newlines, which expectError is matched against.
+func expectErrorText(out *RenderOutput, renderErr error) string {
+	texts := make([]string, 0, 3)
+	if renderErr != nil {
+		texts = append(texts, renderErr.Error())
+	}
+	for _, b := range [][]byte{out.Stderr, out.Stdout} {
+		if t := strings.TrimSpace(string(b)); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// matchesExpectError returns true if the error output contains the expected error or matches it as a regular expression.
+func matchesExpectError(expectError, output string) bool {
+	if strings.Contains(output, expectError) {
+		return true
+	}
+	re, err := regexp.Compile(expectError)
+	if err != nil {
+		log().Debug("expectError is not a valid regular expression. matched as a string", "expectError", expectError, "err", err)
+		return false
+	}
+	return re.MatchString(output)
+}
+
+// checkManifests checks the rendered resources before normalizing dynamic fields
+// by the schema validation and the deprecated API check if enabled.
+// It returns a failure message listing the problems if the test case should fail.
+func (o *ChartSnapshotter) checkManifests(testSpec v1alpha1.SnapshotConfig, out *RenderOutput) (string, error) {
+	validate := o.ValidateSchema || testSpec.ValidateSchema
+	crds := o.ValidateCRDs || testSpec.ValidateCRDs
+	references := o.ValidateReferences || testSpec.ValidateReferences
+
+	manifests, err := yaml.Decode(out.Stdout)
+	if err != nil {
+		// the decode error is reported when taking snapshot
+		log().Debug("skipped checking manifests", "err", err, "path", o.SnapshotFile)
+		return "", nil
+	}
+	schema.SetLogger(log())
+
+	var sb strings.Builder
+	sb.WriteString(o.checkDuplicateResources(manifests))
+	if validate {
+		msg, err := o.validateSchema(manifests)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(msg)
+	}
+	if crds {
+		msg, err := o.validateCRDs(manifests)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(msg)
+	}
+	if references {
+		msg, err := o.validateReferences(testSpec, manifests)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(msg)
+	}
+	if o.TargetKubeVersion != "" {
+		msg, err := o.checkDeprecatedAPIs(testSpec, manifests)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(msg)
+	}
+	return sb.String(), nil
+}
+
+// checkDuplicateResources reports the resources rendered more than once, which helm rejects only at install time.
+// It returns a failure message if any is found and the action is fail. Otherwise they are reported as warnings.
+func (o *ChartSnapshotter) checkDuplicateResources(manifests []*kyaml.RNode) string {
+	findings := schema.FindDuplicateResources(manifests)
+	if len(findings) == 0 {
+		return ""
+	}
+
+	if o.DuplicateResource != DuplicateResourceFail {
+		for _, f := range findings {
+			log().Warn("duplicate resource found", "resource", f.String(), "path", o.SnapshotFile)
+		}
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Duplicate resources found\n")
+	for _, f := range findings {
+		sb.WriteString(fmt.Sprintf("  - %s\n", f.String()))
+	}
+	return sb.String()
+}
+
+// validateSchema returns a failure message listing the schema violations if any.
+func (o *ChartSnapshotter) validateSchema(manifests []*kyaml.RNode) (string, error) {
+	v := &schema.Validator{SchemaDirs: o.SchemaDirs, KubeVersion: o.HelmTemplateCmdOptions.KubeVersion}
+	errs, err := v.Validate(manifests)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate schema: %w", err)
+	}
+	return validationFailure("Schema validation failed", errs), nil
+}
+
+// validateCRDs returns a failure message listing the violations of the custom resources against the CRDs if any.
+func (o *ChartSnapshotter) validateCRDs(manifests []*kyaml.RNode) (string, error) {
+	v := &schema.Validator{}
+	// the CRDs of the chart and its subcharts are read from the chart directory or the fetched archive
+	if chart := o.HelmTemplateCmdOptions.Chart; chart != "" {
+		if err := addChartCRDs(v, chart); err != nil {
+			return "", fmt.Errorf("failed to load CRDs: %w", err)
+		}
+	}
+	for _, dir := range o.CRDDirs {
+		if err := v.AddCRDDir(dir); err != nil {
+			return "", fmt.Errorf("failed to load CRDs: %w", err)
+		}
+	}
+	if err := v.AddCRDs(manifests); err != nil {
+		return "", fmt.Errorf("failed to load CRDs: %w", err)
+	}
+
+	errs, err := v.ValidateCustomResources(manifests)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate custom resources: %w", err)
+	}
+	return validationFailure("CRD validation failed", errs), nil
+}
+
+// addChartCRDs adds the CRDs in the crds directories of the chart and its subcharts to the validator.
+// It does nothing if the chart is not found like the remote chart names.
+func addChartCRDs(v *schema.Validator, chart string) error {
+	crds, err := readChartCRDs(chart)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(crds))
+	for name := range crds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		manifests, err := yaml.Decode(crds[name])
+		if err != nil {
+			return fmt.Errorf("failed to decode '%s': %w", name, err)
+		}
+		if err := v.AddCRDs(manifests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validationFailure returns the failure message with the title listing the violations, or empty if no violation.
+func validationFailure(title string, errs []schema.ValidationError) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(title + "\n")
+	for _, e := range errs {
+		sb.WriteString(fmt.Sprintf("  - %s\n", e.Error()))
+	}
+	return sb.String()
+}
+
+// validateReferences returns a failure message listing the broken references between the rendered resources if any.
+func (o *ChartSnapshotter) validateReferences(testSpec v1alpha1.SnapshotConfig, manifests []*kyaml.RNode) (string, error) {
+	findings, err := schema.FindBrokenReferences(manifests, testSpec.ExternalReferences)
+	if err != nil {
+		return "", fmt.Errorf("failed to validate references: %w", err)
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Reference validation failed\n")
+	for _, f := range findings {
+		sb.WriteString(fmt.Sprintf("  - %s\n", f.String()))
+	}
+	return sb.String(), nil
+}
+
+// checkDeprecatedAPIs reports the resources using deprecated or removed APIs in the target Kubernetes version.
+// It returns a failure message if any is found and the action is fail. Otherwise they are reported as warnings.
+func (o *ChartSnapshotter) checkDeprecatedAPIs(testSpec v1alpha1.SnapshotConfig, manifests []*kyaml.RNode) (string, error) {
+	findings, err := schema.FindDeprecatedAPIs(manifests, o.TargetKubeVersion, testSpec.DeprecatedAPIs)
+	if err != nil {
+		return "", fmt.Errorf("failed to check deprecated APIs: %w", err)
+	}
+	if len(findings) == 0 {
+		return "", nil
+	}
+
+	if o.DeprecatedAPI != DeprecatedAPIFail {
+		for _, f := range findings {
+			log().Warn("deprecated API found", "target", o.TargetKubeVersion, "resource", f.String(), "path", o.SnapshotFile)
+		}
+		return "", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Deprecated APIs found for Kubernetes %s\n", o.TargetKubeVersion))
+	for _, f := range findings {
+		sb.WriteString(fmt.Sprintf("  - %s\n", f.String()))
+	}
+	return sb.String(), nil
+}
+
+// normalizeManifests decodes the rendered output and applies fixed values to the dynamic fields.
+func normalizeManifests(cfg v1alpha1.SnapshotConfig, data []byte) ([]*kyaml.RNode, error) {
+	yaml.SetLogger(log())
+
+	// decode helm output to kustomize/kyaml Nodes
+	manifests, err := yaml.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifests: %w", err)
+	}
+
+	// apply fixed values to dynamic fields
+	if err := yaml.ApplyFixedValueToDynamicFieleds(cfg, manifests); err != nil {
+		return nil, fmt.Errorf("failed to replace json path: %w", err)
+	}
+	return manifests, nil
+}
+
+// assembleManifests returns the normalized manifests of the render output.
+// Hook resources are grouped by phases if groupHooks is enabled, and the rendered NOTES.txt is stored in a dedicated Notes document.
+// stderr is not mixed into the manifests but is stored in a dedicated Stderr document if snapshotStderr is enabled.
+// Otherwise, if the render command failed, the error of helm is snapshotted as a HelmError document,
+// or stderr is snapshotted as Unknown documents if it is not in the known formats.
+func assembleManifests(cfg v1alpha1.SnapshotConfig, out *RenderOutput) ([]*kyaml.RNode, error) {
+	stderr, err := filterStderr(out.Stderr, cfg.IgnoreStderrPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	data := out.Stdout
+	var helmErr *v1alpha1.HelmError
+	if !cfg.SnapshotStderr && out.ExitCode != 0 {
+		// the known errors of helm are snapshotted in the structured form
+		if helmErr = ParseHelmError(string(out.Stderr)); helmErr == nil {
+			data = joinOutput(stderr, out.Stdout)
+		}
+	}
+
+	manifests, err := normalizeManifests(cfg, data)
+	if err != nil {
+		return nil, err
+	}
+	if helmErr != nil {
+		manifests = append(manifests, kyaml.NewRNode(helmErr.Node()))
+	}
+
+	if cfg.GroupHooks {
+		manifests = yaml.GroupHooks(manifests)
+	}
+
+	if out.Notes != "" {
+		manifests = append(manifests, kyaml.NewRNode(v1alpha1.NewNotes(out.Notes).Node()))
+	}
+
+	if cfg.SnapshotStderr {
+		if stderr != "" || out.ExitCode != 0 {
+			doc := kyaml.NewRNode(v1alpha1.NewStderr(stderr, out.ExitCode).Node())
+			manifests = append(manifests, doc)
+		}
+	} else if stderr != "" && out.ExitCode == 0 {
+		log().Warn("render command output to stderr. use snapshotStderr to snapshot it or ignoreStderrPatterns to ignore it", "stderr", stderr)
+	}
+	return manifests, nil
+}
+
+// combinedOutput returns stderr without the lines matching ignoreStderrPatterns followed by stdout.
+func combinedOutput(cfg v1alpha1.SnapshotConfig, out *RenderOutput) ([]byte, error) {
+	stderr, err := filterStderr(out.Stderr, cfg.IgnoreStderrPatterns)
+	if err != nil {
+		return nil, err
+	}
+	return joinOutput(stderr, out.Stdout), nil
+}
+
+// joinOutput places the filtered stderr before stdout.
+// As stdout and stderr are captured separately, the order of their writes is not kept.
+// The snapshots of the failed renders taken by the versions capturing the interleaved output
+// can have the stderr lines after the manifests, and they are reordered once when updated.
+func joinOutput(stderr string, stdout []byte) []byte {
+	if stderr == "" {
+		return stdout
+	}
+	out := make([]byte, 0, len(stderr)+1+len(stdout))
+	out = append(append(out, stderr...), '\n')
+	return append(out, stdout...)
+}
+
+// filterStderr removes the lines matching any of the patterns from stderr
+func filterStderr(stderr []byte, patterns []string) (string, error) {
+	exps := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		exp, err := regexp.Compile(p)
+		if err != nil {
+			return "", fmt.Errorf("invalid ignoreStderrPatterns '%s': %w", p, err)
+		}
+		exps[i] = exp
+	}
+
+	lines := make([]string, 0)
+LINES:
+	for _, line := range strings.Split(string(stderr), "\n") {
+		for _, exp := range exps {
+			if exp.MatchString(line) {
+				continue LINES
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// LoadTestSpec loads the test spec in the values file and merges the given snapshot config into it.
+func LoadTestSpec(valuesFile string, cfg v1alpha1.SnapshotConfig) (v1alpha1.SnapshotConfig, error) {
+	sv := v1alpha1.SnapshotValues{}
+	if valuesFile != "" {
+		err := v1alpha1.FromFile(valuesFile, &sv)
+		if err != nil {
+			return sv.TestSpec, fmt.Errorf("failed to decode values file: %w", err)
+		}
+		// values files can come from anyone sending a test case. only the config file can run commands
+		if sv.TestSpec.Renderer != nil && len(sv.TestSpec.Renderer.Command) > 0 {
+			return sv.TestSpec, fmt.Errorf("renderer.command is not allowed in testSpec of values file '%s'. set it in the config file instead", valuesFile)
+		}
+	}
+	sv.TestSpec.Merge(cfg)
+	return sv.TestSpec, nil
+}
+
 func DefaultSnapshotFilePath(chartPath, valuesFile string) string {
 	// if values file is specified, use the directory of the values file as the snapshot directory.
 	// otherwise, use the chart directory.
@@ -284,3 +878,14 @@ func SnapshotFileName(valuesFile string) string {
 func SnapshotFilePath(dir, valuesFile string) string {
 	return path.Join(dir, "__snapshots__", SnapshotFileName(valuesFile)+".snap")
 }
+
+// MatrixSnapshotFilePath returns the snapshot file path for the matrix entry.
+// e.g. test_ingress_enabled.snap -> test_ingress_enabled@k8s-1.25.snap
+func MatrixSnapshotFilePath(snapshotFile string, m v1alpha1.MatrixEntry) string {
+	id := m.ID()
+	if id == "" {
+		return snapshotFile
+	}
+	ext := path.Ext(snapshotFile)
+	return strings.TrimSuffix(snapshotFile, ext) + "@" + id + ext
+}
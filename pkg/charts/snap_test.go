@@ -2,7 +2,10 @@ package charts
 
 import (
 	"context"
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
@@ -10,6 +13,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/snap"
 )
 
 func TestCharts(t *testing.T) {
@@ -197,6 +201,539 @@ var _ = Describe("Snap", func() {
 		})
 	})
 
+	Context("renderer is configured", func() {
+		It("should snapshot the rendered manifests with dynamic fields", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_stub.bash",
+					ReleaseName: "aaa",
+					Namespace:   "bbb",
+					Chart:       "ccc",
+				},
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					DynamicFields: []v1alpha1.ManifestPath{
+						{
+							APIVersion: "v1",
+							Kind:       "Secret",
+							Name:       "kustomized",
+							JSONPath: []string{
+								"/data/token",
+							},
+							Base64: true,
+						},
+					},
+					Renderer: &v1alpha1.RendererConfig{
+						Command: []string{"cat", "./testdata/rendered.yaml"},
+					},
+				},
+				SnapshotFile:     "__snapshots__/renderer_command.snap",
+				SnapshotVersion:  "v3",
+				DiffContextLineN: 3,
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+
+		It("should not run the command in testSpec of the values file", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:   "./testdata/helm_stub.bash",
+					Chart:      "ccc",
+					ValuesFile: "./testdata/renderer_command_values.yaml",
+				},
+				SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "renderer_command.snap"),
+				SnapshotVersion: "v3",
+			}
+			_, err := ss.Snap(context.Background())
+			Expect(err).To(MatchError("renderer.command is not allowed in testSpec of values file './testdata/renderer_command_values.yaml'. set it in the config file instead"))
+		})
+	})
+
+	Context("render command outputs stderr", func() {
+		It("should not mix stderr into the manifests", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_stderr.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should snapshot filtered stderr in a dedicated document if snapshotStderr is enabled", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_stderr.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					SnapshotStderr:       true,
+					IgnoreStderrPatterns: []string{"^walk.go:[0-9]+: found symbolic link"},
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should snapshot the parsed helm error if the command failed", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_error.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should snapshot stderr as Unknown if the command failed with an unknown error", func() {
+			ss := &ChartSnapshotter{
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					Renderer: &v1alpha1.RendererConfig{Command: []string{"sh", "-c", "echo 'connection refused' >&2; exit 1"}},
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should snapshot filtered stderr as Unknown if the command failed with an unknown error", func() {
+			ss := &ChartSnapshotter{
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					Renderer:             &v1alpha1.RendererConfig{Command: []string{"sh", "-c", "echo 'WARNING: noisy' >&2; echo 'connection refused' >&2; exit 1"}},
+					IgnoreStderrPatterns: []string{"^WARNING: "},
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).NotTo(ContainSubstring("noisy"))
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should return the parsed helm error with the path in the local chart if --fail-helm-error", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_error.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "testdata/lint",
+				},
+				FailHelmError: true,
+			}
+			_, err := ss.Render(context.Background())
+			Expect(err).To(MatchError("'helm template' command failed: exit status 1: testdata/lint/templates/secret.yaml:8:13: apiKey is required"))
+		})
+
+		It("should snapshot stderr and exit code if the command failed and snapshotStderr is enabled", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_error.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					SnapshotStderr: true,
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should fail if ignoreStderrPatterns is invalid", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_stderr.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					IgnoreStderrPatterns: []string{"("},
+				},
+			}
+			_, err := ss.Render(context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("expected errors", func() {
+		var ss *ChartSnapshotter
+		BeforeEach(func() {
+			ss = &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_error.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+				SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "expect_error.snap"),
+				SnapshotVersion: "v3",
+			}
+		})
+
+		It("should snapshot the error if it matches with --fail-helm-error", func() {
+			ss.FailHelmError = true
+			ss.SnapshotConfig.ExpectError = "apiKey is required"
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+
+			b, err := os.ReadFile(ss.SnapshotFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(MatchSnapShot())
+		})
+
+		It("should snapshot the error if it matches the regular expression without --fail-helm-error", func() {
+			ss.SnapshotConfig.ExpectError = `secret\.yaml:\d+:\d+\): \w+ is required`
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+			Expect(ss.SnapshotFile).To(BeAnExistingFile())
+
+			ss.FailHelmError = true
+			res, err = ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("the same snapshot with --fail-helm-error. diff: %s", res.FailureMessage))
+		})
+
+		It("should match the error in stdout of the renderer and snapshot it as Unknown", func() {
+			ss.Renderer = &CommandRenderer{Command: []string{"sh", "-c", "echo 'apiKey is required to render the chart'; exit 2"}}
+			ss.SnapshotConfig.ExpectError = "apiKey is required"
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+
+			b, err := os.ReadFile(ss.SnapshotFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(MatchSnapShot())
+		})
+
+		It("should fail if the error does not match", func() {
+			ss.SnapshotConfig.ExpectError = "password is required"
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+		})
+
+		It("should fail if the render succeeded", func() {
+			ss.HelmTemplateCmdOptions.HelmPath = "./testdata/helm_stub.bash"
+			ss.SnapshotConfig.ExpectError = "apiKey is required"
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+			Expect(ss.SnapshotFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("notes and hooks", func() {
+		It("should snapshot NOTES.txt in a dedicated document and group hooks by phases", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_notes.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					RenderNotes: true,
+					GroupHooks:  true,
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+
+		It("should keep the rendered order if not enabled", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_notes.bash",
+					ReleaseName: "chartsnap",
+					Chart:       "app1",
+				},
+			}
+			out, err := ss.Render(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(out).To(MatchSnapShot())
+		})
+	})
+
+	Context("schema validation", func() {
+		It("should pass if the rendered resources are valid", func() {
+			ss := &ChartSnapshotter{
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					ValidateSchema: true,
+					Renderer:       &v1alpha1.RendererConfig{Command: []string{"cat", "./testdata/rendered.yaml"}},
+				},
+				SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "schema_valid.snap"),
+				SnapshotVersion: "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+			Expect(ss.SnapshotFile).To(BeAnExistingFile())
+		})
+
+		It("should fail with unknown fields without writing the snapshot", func() {
+			snapshotFile := filepath.Join(GinkgoT().TempDir(), "schema_invalid.snap")
+			ss := &ChartSnapshotter{
+				Renderer:        &FileRenderer{Path: "./testdata/schema_invalid.yaml"},
+				ValidateSchema:  true,
+				SnapshotFile:    snapshotFile,
+				SnapshotVersion: "v3",
+				UpdateSnapshot:  true,
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+			Expect(snapshotFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("CRD validation", func() {
+		It("should validate custom resources against the CRDs in the chart", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{Chart: "testdata/operator"},
+				Renderer:               &FileRenderer{Path: "./testdata/widgets.yaml"},
+				ValidateCRDs:           true,
+				SnapshotFile:           filepath.Join(GinkgoT().TempDir(), "widgets.snap"),
+				SnapshotVersion:        "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+		})
+
+		It("should validate custom resources against the CRDs in the chart archive and the subcharts", func() {
+			crd, err := os.ReadFile("testdata/operator/crds/widget.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			dir := GinkgoT().TempDir()
+
+			// fetched remote chart
+			archive := filepath.Join(dir, "operator-0.1.0.tgz")
+			writeChartArchive(GinkgoT(), archive,
+				[2]string{"operator/Chart.yaml", "apiVersion: v2\nname: operator\nversion: 0.1.0\n"},
+				[2]string{"operator/crds/widget.yaml", string(crd)},
+			)
+
+			// umbrella chart with the operator chart in the charts directory
+			umbrella := filepath.Join(dir, "umbrella")
+			Expect(os.MkdirAll(filepath.Join(umbrella, "charts"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(umbrella, "Chart.yaml"), []byte("apiVersion: v2\nname: umbrella\nversion: 0.1.0\n"), 0644)).To(Succeed())
+			Expect(copyFile(archive, filepath.Join(umbrella, "charts", "operator-0.1.0.tgz"))).To(Succeed())
+
+			for _, chart := range []string{"testdata/operator", archive, umbrella} {
+				ss := &ChartSnapshotter{
+					HelmTemplateCmdOptions: HelmTemplateCmdOptions{Chart: chart},
+					Renderer:               &FileRenderer{Path: "./testdata/widgets.yaml"},
+					ValidateCRDs:           true,
+					SnapshotFile:           filepath.Join(GinkgoT().TempDir(), "widgets.snap"),
+					SnapshotVersion:        "v3",
+				}
+				res, err := ss.Snap(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(res.Match).To(BeFalse(), chart)
+				Expect(res.FailureMessage).To(Equal("CRD validation failed\n  - example.com/v1 Widget/widget: spec.replica in body is a forbidden property\n"), chart)
+			}
+		})
+
+		It("should not validate custom resources by the schema validation", func() {
+			ss := &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{Chart: "testdata/operator"},
+				Renderer:               &FileRenderer{Path: "./testdata/widgets.yaml"},
+				ValidateSchema:         true,
+				SnapshotFile:           filepath.Join(GinkgoT().TempDir(), "widgets.snap"),
+				SnapshotVersion:        "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+	})
+
+	Context("duplicate resources", func() {
+		It("should warn duplicate resources and take snapshot by default", func() {
+			ss := &ChartSnapshotter{
+				Renderer:        &FileRenderer{Path: "./testdata/duplicate.yaml"},
+				SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "duplicate.snap"),
+				SnapshotVersion: "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+
+		It("should fail with duplicate resources if the action is fail", func() {
+			snapshotFile := filepath.Join(GinkgoT().TempDir(), "duplicate.snap")
+			ss := &ChartSnapshotter{
+				Renderer:          &FileRenderer{Path: "./testdata/duplicate.yaml"},
+				DuplicateResource: DuplicateResourceFail,
+				SnapshotFile:      snapshotFile,
+				SnapshotVersion:   "v3",
+				UpdateSnapshot:    true,
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+			Expect(snapshotFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("reference validation", func() {
+		It("should fail with broken references without writing the snapshot", func() {
+			snapshotFile := filepath.Join(GinkgoT().TempDir(), "broken_references.snap")
+			ss := &ChartSnapshotter{
+				Renderer:           &FileRenderer{Path: "./testdata/broken_references.yaml"},
+				ValidateReferences: true,
+				SnapshotFile:       snapshotFile,
+				SnapshotVersion:    "v3",
+				UpdateSnapshot:     true,
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+			Expect(snapshotFile).NotTo(BeAnExistingFile())
+		})
+
+		It("should pass if the broken references are external", func() {
+			ss := &ChartSnapshotter{
+				SnapshotConfig: v1alpha1.SnapshotConfig{
+					ValidateReferences: true,
+					ExternalReferences: []string{"Service/app", "ServiceAccount/app", "Secret/*"},
+				},
+				Renderer:        &FileRenderer{Path: "./testdata/broken_references.yaml"},
+				SnapshotFile:    filepath.Join(GinkgoT().TempDir(), "broken_references.snap"),
+				SnapshotVersion: "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+	})
+
+	Context("deprecated APIs", func() {
+		It("should warn deprecated APIs and take snapshot by default", func() {
+			ss := &ChartSnapshotter{
+				Renderer:          &FileRenderer{Path: "./testdata/deprecated.yaml"},
+				TargetKubeVersion: "1.29",
+				SnapshotFile:      filepath.Join(GinkgoT().TempDir(), "deprecated.snap"),
+				SnapshotVersion:   "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+
+		It("should fail with deprecated APIs if the action is fail", func() {
+			ss := &ChartSnapshotter{
+				Renderer:          &FileRenderer{Path: "./testdata/deprecated.yaml"},
+				TargetKubeVersion: "1.29",
+				DeprecatedAPI:     DeprecatedAPIFail,
+				SnapshotFile:      filepath.Join(GinkgoT().TempDir(), "deprecated.snap"),
+				SnapshotVersion:   "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(MatchSnapShot())
+		})
+
+		It("should pass if the APIs are not deprecated yet", func() {
+			ss := &ChartSnapshotter{
+				Renderer:          &FileRenderer{Path: "./testdata/deprecated.yaml"},
+				TargetKubeVersion: "1.20",
+				DeprecatedAPI:     DeprecatedAPIFail,
+				SnapshotFile:      filepath.Join(GinkgoT().TempDir(), "deprecated.snap"),
+				SnapshotVersion:   "v3",
+			}
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+	})
+
+	Context("snapshot header", func() {
+		var snapshotFile string
+
+		newSnapshotter := func() *ChartSnapshotter {
+			return &ChartSnapshotter{
+				HelmTemplateCmdOptions: HelmTemplateCmdOptions{
+					HelmPath:    "./testdata/helm_stderr.bash",
+					ReleaseName: "chartsnap",
+					Namespace:   "default",
+					Chart:       "../../example/app1",
+				},
+				SnapshotFile:    snapshotFile,
+				SnapshotVersion: SnapshotVersionV3,
+				HeaderVersion:   "v0.5.0",
+				HelmVersion:     "v3.15.4",
+			}
+		}
+
+		// snapshot files are cached in snap package
+		rewriteHeader := func(header string) {
+			b, err := snap.ReadFile(snapshotFile)
+			Expect(err).NotTo(HaveOccurred())
+			_, rest, _ := strings.Cut(string(b), "\n")
+			Expect(snap.WriteFile(snapshotFile, []byte(header+"\n"+rest))).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			snapshotFile = filepath.Join(GinkgoT().TempDir(), "__snapshots__", "default.snap")
+			res, err := newSnapshotter().Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrue())
+		})
+
+		It("should write chart and tool metadata", func() {
+			b, err := os.ReadFile(snapshotFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.SplitN(string(b), "\n", 2)[0]).To(Equal("# chartsnap: snapshot_version=v3 chart=app1 chart_version=0.1.0 app_version=1.16.0 helm_version=v3.15.4 chartsnap_version=v0.5.0 release_name=chartsnap namespace=default"))
+		})
+
+		It("should not treat header-only changes as mismatches", func() {
+			rewriteHeader("# chartsnap: snapshot_version=v3 helm_version=v3.14.0 unknown=xxx")
+			res, err := newSnapshotter().Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+		})
+
+		It("should fail if chart version is different and the action is fail", func() {
+			rewriteHeader("# chartsnap: snapshot_version=v3 chart=app1 chart_version=0.0.1")
+
+			ss := newSnapshotter()
+			ss.ChartVersionMismatch = ChartVersionMismatchWarn
+			res, err := ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrueBecause("diff: %s", res.FailureMessage))
+
+			ss = newSnapshotter()
+			ss.ChartVersionMismatch = ChartVersionMismatchFail
+			res, err = ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeFalse())
+			Expect(res.FailureMessage).To(ContainSubstring("chart version in the snapshot is 0.0.1 but the rendered chart is 0.1.0"))
+
+			ss = newSnapshotter()
+			ss.ChartVersionMismatch = ChartVersionMismatchFail
+			ss.UpdateSnapshot = true
+			res, err = ss.Snap(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res.Match).To(BeTrue())
+		})
+	})
+
 	Context("empty snapshot", func() {
 		It("should be successfull and no error occers (after v3)", func() {
 			ss := &ChartSnapshotter{
@@ -342,6 +879,56 @@ var _ = Describe("Snap", func() {
 	})
 })
 
+func TestExpectErrorText(t *testing.T) {
+	tests := []struct {
+		name      string
+		out       *RenderOutput
+		renderErr error
+		want      string
+	}{
+		{
+			name:      "error, stderr and stdout",
+			out:       &RenderOutput{Stdout: []byte("out\n"), Stderr: []byte("Error: failed\n\n"), ExitCode: 1},
+			renderErr: errors.New("exit status 1"),
+			want:      "exit status 1\nError: failed\nout",
+		},
+		{
+			name: "stderr only",
+			out:  &RenderOutput{Stderr: []byte("Error: failed\n"), ExitCode: 1},
+			want: "Error: failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expectErrorText(tt.out, tt.renderErr); got != tt.want {
+				t.Errorf("expectErrorText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesExpectError(t *testing.T) {
+	output := "Error: execution error at (app1/templates/secret.yaml:8:13): apiKey is required"
+	tests := []struct {
+		name        string
+		expectError string
+		want        bool
+	}{
+		{name: "exact", expectError: "apiKey is required", want: true},
+		{name: "regular expression", expectError: `\(app1/templates/\w+\.yaml:\d+:\d+\)`, want: true},
+		{name: "not matched", expectError: "password is required", want: false},
+		{name: "invalid regular expression contained", expectError: "(app1/templates/secret.yaml", want: true},
+		{name: "invalid regular expression not contained", expectError: "(app2", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesExpectError(tt.expectError, output); got != tt.want {
+				t.Errorf("matchesExpectError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSnapshotFileName(t *testing.T) {
 	type args struct {
 		valuesFile string
@@ -461,3 +1048,47 @@ func TestSnapshotFilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestMatrixSnapshotFilePath(t *testing.T) {
+	type args struct {
+		snapshotFile string
+		matrix       v1alpha1.MatrixEntry
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "no matrix",
+			args: args{
+				snapshotFile: "test/__snapshots__/test_ingress_enabled.snap",
+				matrix:       v1alpha1.MatrixEntry{},
+			},
+			want: "test/__snapshots__/test_ingress_enabled.snap",
+		},
+		{
+			name: "kube version",
+			args: args{
+				snapshotFile: "test/__snapshots__/test_ingress_enabled.snap",
+				matrix:       v1alpha1.MatrixEntry{KubeVersion: "1.25"},
+			},
+			want: "test/__snapshots__/test_ingress_enabled@k8s-1.25.snap",
+		},
+		{
+			name: "named",
+			args: args{
+				snapshotFile: "__snapshots__/default.snap",
+				matrix:       v1alpha1.MatrixEntry{Name: "legacy", KubeVersion: "1.21", APIVersions: []string{"policy/v1beta1"}},
+			},
+			want: "__snapshots__/default@legacy.snap",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatrixSnapshotFilePath(tt.args.snapshotFile, tt.args.matrix); got != tt.want {
+				t.Errorf("MatrixSnapshotFilePath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+#!/bin/bash
+# fake helm which renders the lines of the values files except 'unused',
+# and 'host' only if ingress is enabled by any values file
+values=()
+for arg in "$@"; do
+  case "$arg" in
+    --values=*) values+=("${arg#--values=}") ;;
+  esac
+done
+
+lines=""
+ingress=false
+if [ ${#values[@]} -gt 0 ]; then
+  lines=$(cat "${values[@]}" | grep -v -e unused -e '^testSpec' -e snapshotStderr -e '^ingress:')
+  grep -q "enabled: true" "${values[@]}" && ingress=true
+fi
+if [ "$ingress" = false ]; then
+  lines=$(echo "$lines" | grep -v host)
+fi
+
+cat <<EOT
+---
+# Source: analyze/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+data:
+  values: |
+$(echo "$lines" | sed 's/^/    /')
+EOT
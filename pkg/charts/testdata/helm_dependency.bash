@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# record the calls to check the command is executed only once
+echo "$*" >> "$3/../helm_calls"
+
+if [ "$1" != "dependency" ] || [ "$2" != "build" ]; then
+  echo "unexpected args: $*" >&2
+  exit 1
+fi
+
+mkdir -p "$3/charts"
+echo "common" > "$3/charts/common-2.19.3.tgz"
+echo "app1" > "$3/charts/app1-0.1.0.tgz"
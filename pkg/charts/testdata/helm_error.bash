@@ -0,0 +1,8 @@
+#!/bin/bash
+
+cat >&2 <<EOF2
+Error: execution error at (app1/templates/secret.yaml:8:13): apiKey is required
+
+Use --debug flag to render out invalid YAML
+EOF2
+exit 1
@@ -0,0 +1,50 @@
+#!/bin/bash
+# fake helm for the fuzz chart which fails if name is empty,
+# renders invalid YAML if replicas is negative and duplicates the Service if ingress is enabled.
+# it also fails if crash is true, which is not in the values of the chart
+values=()
+for arg in "$@"; do
+  case "$arg" in
+    --values=*) values+=("${arg#--values=}") ;;
+  esac
+done
+
+if [ ${#values[@]} -gt 0 ]; then
+  if grep -q '^crash: true' "${values[@]}"; then
+    echo 'Error: execution error at (fuzz/templates/deployment.yaml:1:3): crashed' >&2
+    exit 1
+  fi
+  if grep -q -e '^name: ""' -e '^name: null' "${values[@]}"; then
+    echo 'Error: execution error at (fuzz/templates/deployment.yaml:4:11): name is required' >&2
+    exit 1
+  fi
+  grep -q '^replicas: -' "${values[@]}" && replicas="-1: {" || replicas=1
+  grep -q '^  enabled: true' "${values[@]}" && ingress=true
+fi
+
+cat <<EOT
+---
+# Source: fuzz/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: ${replicas:-1}
+---
+# Source: fuzz/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+EOT
+if [ "$ingress" = true ]; then
+cat <<EOT
+---
+# Source: fuzz/templates/ingress.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+EOT
+fi
@@ -0,0 +1,18 @@
+#!/bin/bash
+# fake helm which renders the text of the templates of the chart except partials and NOTES.txt,
+# so that any mutation of them changes the manifests
+chart=$3
+for f in "$chart"/templates/*.yaml; do
+  [ -f "$f" ] || continue
+  cat <<EOT
+---
+# Source: mutate/templates/$(basename "$f")
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: $(basename "$f" .yaml)
+data:
+  template: |
+$(sed 's/^/    /' "$f")
+EOT
+done
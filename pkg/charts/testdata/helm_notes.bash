@@ -0,0 +1,34 @@
+#!/bin/bash
+
+if [ "$1" = "install" ]; then
+  cat <<EOF2
+{"name":"$2","info":{"status":"pending-install","notes":"1. Get the application URL by running these commands:\n  export POD_NAME=\$(kubectl get pods --namespace default -l \"app.kubernetes.io/name=app1\" -o jsonpath=\"{.items[0].metadata.name}\")\n\nargs: $*\n"}}
+EOF2
+  exit 0
+fi
+
+cat <<EOF2
+---
+# Source: app1/templates/tests/test-connection.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: chartsnap-app1-test-connection
+  annotations:
+    helm.sh/hook: test
+---
+# Source: app1/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: chartsnap-app1-migrate
+  annotations:
+    helm.sh/hook: pre-upgrade,pre-install
+    helm.sh/hook-weight: "5"
+---
+# Source: app1/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: chartsnap-app1
+EOF2
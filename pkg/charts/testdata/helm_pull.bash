@@ -0,0 +1,33 @@
+#!/bin/bash
+
+# helm pull --destination DIR CHART [--repo REPO] [--version VERSION] [flags]
+# helm show chart CHART [--repo REPO] [flags]
+cmd="$1"
+chart=""
+repo=""
+dest=""
+version=""
+shift
+[ "$cmd" = "show" ] && shift
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --destination) dest="$2"; shift ;;
+    --version) version="$2"; shift ;;
+    --repo) repo="$2"; shift ;;
+    --*) ;;
+    *) chart=$(basename "$1") ;;
+  esac
+  shift
+done
+
+# record the calls to check the commands are executed only once
+echo "$cmd $chart $repo $version" | sed 's/  */ /g; s/ $//' >> "$HELM_CALLS"
+
+if [ "$cmd" = "show" ]; then
+  # the latest version is 1.0.0 and any version range is resolved to 1.2.3
+  resolved="1.0.0"
+  [ -n "$version" ] && resolved="1.2.3"
+  printf "apiVersion: v2\nname: %s\nversion: %s\n" "$chart" "$resolved"
+  exit 0
+fi
+echo "$chart-$version" > "$dest/$chart-$version.tgz"
@@ -0,0 +1,15 @@
+#!/bin/bash
+
+cat >&2 <<EOF2
+walk.go:74: found symbolic link in path: /charts/app1/templates/link.yaml resolves to /charts/common/link.yaml. Contents of linked file included and used
+WARNING: this chart is deprecated
+EOF2
+
+cat <<EOF2
+---
+# Source: app1/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: chartsnap-app1
+EOF2
@@ -152,4 +152,17 @@ spec:
       image: busybox
       name: wget
   restartPolicy: Never
-EOF
\ No newline at end of file
+EOF
+# the instrumented chart of the branch coverage
+if [[ "$*" == *chartsnap-coverage-* ]]; then
+cat <<EOF
+---
+# Source: app1/templates/hpa.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: chartsnap-branches
+data:
+  "6": "true"
+EOF
+fi
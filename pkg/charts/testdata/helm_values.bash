@@ -0,0 +1,27 @@
+#!/bin/bash
+# fake helm which fails like a chart with a strict values.schema.json if the values file has testSpec
+for arg in "$@"; do
+  case "$arg" in
+    --values=*) values="${arg#--values=}" ;;
+  esac
+done
+
+if grep -q "^testSpec:" "$values"; then
+  echo "Error: values don't meet the specifications of the schema(s) in the following chart(s):" >&2
+  echo "app1: Additional property testSpec is not allowed" >&2
+  exit 1
+fi
+if grep -q "invalid" "$values"; then
+  echo "Error: failed to parse $values: error converting YAML to JSON" >&2
+  exit 1
+fi
+
+cat <<EOT
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+data:
+  values.yaml: |
+$(sed 's/^/    /' "$values")
+EOT
@@ -0,0 +1,3 @@
+{{- define "mutate.name" -}}
+{{- if .Values.nameOverride }}{{ .Values.nameOverride }}{{ else }}{{ default "mutate" .Chart.Name }}{{ end }}
+{{- end }}
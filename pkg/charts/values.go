@@ -0,0 +1,59 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const testSpecKey = "testSpec"
+
+// sanitizeValuesFile writes a copy of the values file without testSpec into a temporary file,
+// so that testSpec does not leak into .Values or fail charts with a strict values.schema.json.
+// It returns the original path if the values file has no testSpec.
+// The returned cleanup function removes the temporary file.
+func sanitizeValuesFile(valuesFile string) (string, func(), error) {
+	nop := func() {}
+	if valuesFile == "" {
+		return valuesFile, nop, nil
+	}
+	b, err := os.ReadFile(valuesFile)
+	if err != nil {
+		// helm reports the error with the original path
+		return valuesFile, nop, nil
+	}
+	node, err := kyaml.Parse(string(b))
+	if err != nil || node.YNode().Kind != kyaml.MappingNode || node.Field(testSpecKey) == nil {
+		return valuesFile, nop, nil
+	}
+
+	if _, err := node.Pipe(kyaml.Clear(testSpecKey)); err != nil {
+		return "", nop, fmt.Errorf("failed to remove testSpec from values file: %w", err)
+	}
+	f, err := os.CreateTemp("", "chartsnap-values-*.yaml")
+	if err != nil {
+		return "", nop, fmt.Errorf("failed to create sanitized values file: %w", err)
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	defer f.Close()
+
+	// an empty mapping is written as '{}' if the values file has only testSpec
+	if _, err := f.WriteString(node.MustString()); err != nil {
+		cleanup()
+		return "", nop, fmt.Errorf("failed to write sanitized values file: %w", err)
+	}
+	log().Debug("testSpec is removed from values file", "path", valuesFile, "sanitized", f.Name())
+	return f.Name(), cleanup, nil
+}
+
+// restoreValuesFilePath replaces the path of the sanitized values file in the output with the original path
+// so that error messages point at the file users wrote.
+func restoreValuesFilePath(out *RenderOutput, sanitized, original string) {
+	if out == nil || sanitized == original {
+		return
+	}
+	out.Stdout = bytes.ReplaceAll(out.Stdout, []byte(sanitized), []byte(original))
+	out.Stderr = bytes.ReplaceAll(out.Stderr, []byte(sanitized), []byte(original))
+}
@@ -0,0 +1,68 @@
+package charts
+
+import (
+	"context"
+	"os"
+
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("values file", func() {
+	Context("sanitizeValuesFile", func() {
+		It("should write a copy without testSpec", func() {
+			sanitized, cleanup, err := sanitizeValuesFile("testdata/values/test_spec.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sanitized).NotTo(Equal("testdata/values/test_spec.yaml"))
+
+			b, err := os.ReadFile(sanitized)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(MatchSnapShot())
+
+			cleanup()
+			Expect(sanitized).NotTo(BeAnExistingFile())
+		})
+
+		It("should write an empty mapping if the values file has only testSpec", func() {
+			sanitized, cleanup, err := sanitizeValuesFile("testdata/values/only_test_spec.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			defer cleanup()
+			Expect(os.ReadFile(sanitized)).To(BeEquivalentTo("{}\n"))
+		})
+
+		It("should return the original path if the values file has no testSpec or is not found", func() {
+			for _, f := range []string{"", "testdata/rendered.yaml", "testdata/not-found.yaml"} {
+				sanitized, cleanup, err := sanitizeValuesFile(f)
+				Expect(err).NotTo(HaveOccurred())
+				cleanup()
+				Expect(sanitized).To(Equal(f))
+			}
+		})
+	})
+
+	Context("helm template", func() {
+		ht := HelmTemplateCmdOptions{
+			HelmPath:    "./testdata/helm_values.bash",
+			ReleaseName: "chartsnap",
+			Chart:       "app1",
+		}
+
+		It("should not pass testSpec to helm", func() {
+			ht := ht
+			ht.ValuesFile = "testdata/values/test_spec.yaml"
+			out, err := ht.Execute(context.Background())
+			Expect(err).NotTo(HaveOccurred(), string(out.Stderr))
+			Expect(string(out.Stdout)).NotTo(ContainSubstring("testSpec"))
+			Expect(string(out.Stdout)).To(ContainSubstring("replicaCount: 2"))
+		})
+
+		It("should point at the original values file in errors", func() {
+			ht := ht
+			ht.ValuesFile = "testdata/values/invalid.yaml"
+			out, err := ht.Execute(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(string(out.Stderr)).To(Equal("Error: failed to parse testdata/values/invalid.yaml: error converting YAML to JSON\n"))
+		})
+	})
+})
@@ -0,0 +1,96 @@
+package charts
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Worktree is a temporary git worktree checked out at a ref
+// to render the chart and the test values of the ref side by side with the working tree.
+type Worktree struct {
+	// Ref is the git ref checked out in the worktree.
+	Ref string
+	// Toplevel is the root directory of the working tree of the git repository.
+	Toplevel string
+	// Dir is the root directory of the temporary worktree.
+	Dir string
+}
+
+// NewWorktree checks out the ref of the git repository containing the path into a temporary worktree.
+// The worktree must be removed by Remove.
+func NewWorktree(ctx context.Context, path, ref string) (*Worktree, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := abs
+	if stat, err := os.Stat(abs); err == nil && !stat.IsDir() {
+		dir = filepath.Dir(abs)
+	}
+
+	out, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not in a git repository: %w", path, err)
+	}
+	// resolve symlinks not to fail to map the paths e.g. /tmp on macOS
+	toplevel, err := filepath.EvalSymlinks(strings.TrimSpace(out))
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "chartsnap-worktree-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+	w := &Worktree{Ref: ref, Toplevel: toplevel, Dir: filepath.Join(tmp, "worktree")}
+
+	log().Debug("adding git worktree", "ref", ref, "dir", w.Dir)
+	if _, err := git(ctx, toplevel, "worktree", "add", "--detach", "--quiet", w.Dir, ref); err != nil {
+		os.RemoveAll(tmp)
+		return nil, fmt.Errorf("failed to check out '%s': %w", ref, err)
+	}
+	return w, nil
+}
+
+// Path returns the path in the worktree corresponding to the path in the working tree.
+// It returns false if the path is outside of the repository or does not exist at the ref.
+func (w *Worktree) Path(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(w.Toplevel, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	p := filepath.Join(w.Dir, rel)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	return p, true
+}
+
+// Remove removes the worktree and its temporary directory.
+func (w *Worktree) Remove(ctx context.Context) error {
+	defer os.RemoveAll(filepath.Dir(w.Dir))
+	if _, err := git(ctx, w.Toplevel, "worktree", "remove", "--force", w.Dir); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
+	return nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	out, err := runCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out.Stderr)))
+	}
+	return string(out.Stdout), nil
+}
@@ -0,0 +1,66 @@
+package charts
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Worktree", func() {
+	var repo string
+
+	gitRun := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(out))
+	}
+
+	BeforeEach(func() {
+		repo = GinkgoT().TempDir()
+		gitRun("init", "--quiet", "--initial-branch=main")
+		Expect(os.MkdirAll(filepath.Join(repo, "charts", "app1"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(repo, "charts", "app1", "Chart.yaml"), []byte("name: app1\nversion: 0.1.0\n"), 0644)).To(Succeed())
+		gitRun("add", "-A")
+		gitRun("commit", "--quiet", "-m", "init")
+
+		Expect(os.WriteFile(filepath.Join(repo, "charts", "app1", "Chart.yaml"), []byte("name: app1\nversion: 0.2.0\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(repo, "charts", "app1", "values.yaml"), []byte("{}\n"), 0644)).To(Succeed())
+	})
+
+	It("should check out the ref and map the paths in the working tree", func() {
+		w, err := NewWorktree(context.Background(), filepath.Join(repo, "charts", "app1"), "main")
+		Expect(err).NotTo(HaveOccurred())
+
+		chart, ok := w.Path(filepath.Join(repo, "charts", "app1"))
+		Expect(ok).To(BeTrue())
+		meta, err := ReadChartMetadata(chart)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.Version).To(Equal("0.1.0"))
+
+		// not committed at the ref
+		_, ok = w.Path(filepath.Join(repo, "charts", "app1", "values.yaml"))
+		Expect(ok).To(BeFalse())
+		// outside of the repository
+		_, ok = w.Path(GinkgoT().TempDir())
+		Expect(ok).To(BeFalse())
+
+		Expect(w.Remove(context.Background())).To(Succeed())
+		Expect(w.Dir).NotTo(BeADirectory())
+	})
+
+	It("should fail if the ref is not found", func() {
+		_, err := NewWorktree(context.Background(), repo, "not-found")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("failed to check out 'not-found'"))
+	})
+
+	It("should fail if the path is not in a git repository", func() {
+		_, err := NewWorktree(context.Background(), GinkgoT().TempDir(), "main")
+		Expect(err).To(HaveOccurred())
+	})
+})
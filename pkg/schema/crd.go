@@ -0,0 +1,214 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+const preserveUnknownFields = "x-kubernetes-preserve-unknown-fields"
+
+// customResourceDefinition is the part of CustomResourceDefinition used for the validation.
+// Both apiextensions.k8s.io/v1 and v1beta1 are supported.
+type customResourceDefinition struct {
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name   string           `json:"name"`
+			Schema *crdSchemaHolder `json:"schema"`
+		} `json:"versions"`
+		// v1beta1 only
+		Version    string           `json:"version"`
+		Validation *crdSchemaHolder `json:"validation"`
+	} `json:"spec"`
+}
+
+type crdSchemaHolder struct {
+	OpenAPIV3Schema *spec.Schema `json:"openAPIV3Schema"`
+}
+
+func isCRD(m *kyaml.RNode) bool {
+	return m.GetKind() == "CustomResourceDefinition" && strings.HasPrefix(m.GetApiVersion(), "apiextensions.k8s.io/")
+}
+
+// AddCRDs registers the OpenAPI v3 schemas of the CustomResourceDefinitions in the manifests
+// to validate the custom resources. The other documents are ignored.
+func (v *Validator) AddCRDs(manifests []*kyaml.RNode) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.crds == nil {
+		v.crds = make(map[string]*spec.Schema)
+	}
+
+	for _, m := range manifests {
+		if !isCRD(m) {
+			continue
+		}
+		raw, err := m.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode CustomResourceDefinition %s: %w", m.GetName(), err)
+		}
+		var crd customResourceDefinition
+		if err := json.Unmarshal(raw, &crd); err != nil {
+			return fmt.Errorf("failed to decode CustomResourceDefinition %s: %w", m.GetName(), err)
+		}
+
+		for _, ver := range crd.Spec.Versions {
+			s := crd.Spec.Validation
+			if ver.Schema != nil {
+				s = ver.Schema
+			}
+			if s == nil || s.OpenAPIV3Schema == nil {
+				continue
+			}
+			v.crds[crd.Spec.Group+"/"+ver.Name+"/"+crd.Spec.Names.Kind] = structural(s.OpenAPIV3Schema)
+		}
+		if crd.Spec.Version != "" && crd.Spec.Validation != nil && crd.Spec.Validation.OpenAPIV3Schema != nil {
+			v.crds[crd.Spec.Group+"/"+crd.Spec.Version+"/"+crd.Spec.Names.Kind] = structural(crd.Spec.Validation.OpenAPIV3Schema)
+		}
+		log().Debug("CustomResourceDefinition loaded", "name", m.GetName())
+	}
+	return nil
+}
+
+// AddCRDDir registers the CustomResourceDefinitions in the YAML or JSON files under the directory.
+// It does nothing if the directory does not exist.
+func (v *Validator) AddCRDDir(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		manifests, err := yaml.Decode(b)
+		if err != nil {
+			return fmt.Errorf("failed to decode '%s': %w", path, err)
+		}
+		return v.AddCRDs(manifests)
+	})
+}
+
+// crdSchema returns the schema of the custom resource or nil if the CRD is not registered.
+func (v *Validator) crdSchema(apiVersion, kind string) *spec.Schema {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !strings.Contains(apiVersion, "/") {
+		return nil
+	}
+	return v.crds[apiVersion+"/"+kind]
+}
+
+// structural makes the schema strict like the API server which prunes unknown fields,
+// so that misspelled fields are reported. The fields of the object metadata are always allowed.
+func structural(s *spec.Schema) *spec.Schema {
+	s = strict(s)
+	if s.Properties == nil {
+		s.Properties = make(map[string]spec.Schema)
+	}
+	for _, f := range []string{"apiVersion", "kind"} {
+		if _, ok := s.Properties[f]; !ok {
+			s.Properties[f] = *spec.StringProperty()
+		}
+	}
+	s.Properties["metadata"] = spec.Schema{SchemaProps: spec.SchemaProps{Type: spec.StringOrArray{"object"}}}
+	return s
+}
+
+// strict closes the object schemas by additionalProperties: false.
+// The schema is left open if it preserves unknown fields or declares additionalProperties by itself,
+// or if its allOf, anyOf or oneOf subschemas declare the fields, which are not known at the level of the schema.
+func strict(s *spec.Schema) *spec.Schema {
+	return strictSchema(s, true)
+}
+
+// strictSchema closes the schema if close is true and the nested object schemas.
+func strictSchema(s *spec.Schema, close bool) *spec.Schema {
+	if s == nil {
+		return nil
+	}
+	out := *s
+	if preservesUnknownFields(&out) {
+		return &out
+	}
+
+	if len(out.Properties) > 0 {
+		props := make(map[string]spec.Schema, len(out.Properties))
+		for k, p := range out.Properties {
+			props[k] = *strict(&p)
+		}
+		out.Properties = props
+		if close && out.AdditionalProperties == nil && !subschemasDeclareFields(&out) {
+			out.AdditionalProperties = &spec.SchemaOrBool{Allows: false}
+		}
+	}
+	if out.AdditionalProperties != nil && out.AdditionalProperties.Schema != nil {
+		out.AdditionalProperties = &spec.SchemaOrBool{Allows: true, Schema: strict(out.AdditionalProperties.Schema)}
+	}
+	if out.Items != nil && out.Items.Schema != nil {
+		out.Items = &spec.SchemaOrArray{Schema: strict(out.Items.Schema)}
+	}
+	// the subschemas are not closed since each of them declares a part of the fields
+	out.AllOf = openSubschemas(out.AllOf)
+	out.AnyOf = openSubschemas(out.AnyOf)
+	out.OneOf = openSubschemas(out.OneOf)
+	return &out
+}
+
+func openSubschemas(schemas []spec.Schema) []spec.Schema {
+	if len(schemas) == 0 {
+		return schemas
+	}
+	out := make([]spec.Schema, 0, len(schemas))
+	for i := range schemas {
+		out = append(out, *strictSchema(&schemas[i], false))
+	}
+	return out
+}
+
+// preservesUnknownFields returns true if x-kubernetes-preserve-unknown-fields is set in the schema or its allOf, anyOf or oneOf subschemas.
+func preservesUnknownFields(s *spec.Schema) bool {
+	if preserve, _ := s.Extensions.GetBool(preserveUnknownFields); preserve {
+		return true
+	}
+	for _, sub := range slices.Concat(s.AllOf, s.AnyOf, s.OneOf) {
+		if preservesUnknownFields(&sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// subschemasDeclareFields returns true if the allOf, anyOf or oneOf subschemas declare properties or additionalProperties.
+func subschemasDeclareFields(s *spec.Schema) bool {
+	for _, sub := range slices.Concat(s.AllOf, s.AnyOf, s.OneOf) {
+		if len(sub.Properties) > 0 || sub.AdditionalProperties != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+func TestFindDeprecatedAPIs(t *testing.T) {
+	manifests, err := yaml.Decode([]byte(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: pdb
+---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: hpa
+---
+apiVersion: example.com/v1alpha1
+kind: Widget
+metadata:
+  name: widget
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		table   []v1alpha1.DeprecatedAPI
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "before deprecation",
+			target: "1.20",
+			want:   []string{},
+		},
+		{
+			name:   "deprecated",
+			target: "1.23.0",
+			want: []string{
+				"policy/v1beta1 PodDisruptionBudget/pdb: deprecated in 1.21. use policy/v1 instead",
+				"autoscaling/v2beta2 HorizontalPodAutoscaler/hpa: deprecated in 1.23. use autoscaling/v2 instead",
+			},
+		},
+		{
+			name:   "removed",
+			target: "v1.29",
+			want: []string{
+				"policy/v1beta1 PodDisruptionBudget/pdb: removed in 1.25. use policy/v1 instead",
+				"autoscaling/v2beta2 HorizontalPodAutoscaler/hpa: removed in 1.26. use autoscaling/v2 instead",
+			},
+		},
+		{
+			name:   "table in config",
+			target: "1.29",
+			table: []v1alpha1.DeprecatedAPI{
+				{APIVersion: "example.com/v1alpha1", Kind: "Widget", DeprecatedIn: "1.28", Replacement: "example.com/v1"},
+				{APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.23", RemovedIn: "1.30"},
+			},
+			want: []string{
+				"policy/v1beta1 PodDisruptionBudget/pdb: removed in 1.25. use policy/v1 instead",
+				"autoscaling/v2beta2 HorizontalPodAutoscaler/hpa: deprecated in 1.23",
+				"example.com/v1alpha1 Widget/widget: deprecated in 1.28. use example.com/v1 instead",
+			},
+		},
+		{
+			name:    "invalid target version",
+			target:  "latest",
+			wantErr: true,
+		},
+		{
+			name:    "invalid version in table",
+			target:  "1.29",
+			table:   []v1alpha1.DeprecatedAPI{{APIVersion: "apps/v1", Kind: "Deployment", RemovedIn: "next"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := FindDeprecatedAPIs(manifests, tt.target, tt.table)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindDeprecatedAPIs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make([]string, 0, len(findings))
+			for _, f := range findings {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindDeprecatedAPIs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+)
+
+// DuplicateFinding is a resource identity rendered more than once.
+type DuplicateFinding struct {
+	// Group is the API group of the resource. core for the core group.
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+	// Count is the number of the documents with the identity.
+	Count int
+}
+
+// ID returns the identity of the resource. e.g. apps/Deployment default/app
+func (f DuplicateFinding) ID() string {
+	return fmt.Sprintf("%s/%s %s/%s", f.Group, f.Kind, f.Namespace, f.Name)
+}
+
+func (f DuplicateFinding) String() string {
+	return fmt.Sprintf("%s: rendered %d times", f.ID(), f.Count)
+}
+
+// FindDuplicateResources returns the resources whose API group, kind, namespace and name are the same as another one
+// in the order of their first appearance. The versions of the API are not compared as they are the same resource in a cluster.
+// The documents generated by chartsnap such as Unknown are skipped.
+func FindDuplicateResources(manifests []*kyaml.RNode) []DuplicateFinding {
+	index := make(map[string]int)
+	findings := make([]DuplicateFinding, 0)
+	for _, m := range manifests {
+		if m.GetKind() == "" || m.GetName() == "" || m.GetApiVersion() == v1alpha1.GroupVersion.String() {
+			continue
+		}
+		group, _, ok := strings.Cut(m.GetApiVersion(), "/")
+		if !ok {
+			group = "core"
+		}
+		f := DuplicateFinding{Group: group, Kind: m.GetKind(), Namespace: m.GetNamespace(), Name: m.GetName()}
+		i, ok := index[f.ID()]
+		if !ok {
+			index[f.ID()] = len(findings)
+			findings = append(findings, f)
+			i = len(findings) - 1
+		}
+		findings[i].Count++
+	}
+
+	dups := make([]DuplicateFinding, 0)
+	for _, f := range findings {
+		if f.Count > 1 {
+			dups = append(dups, f)
+		}
+	}
+	return dups
+}
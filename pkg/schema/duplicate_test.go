@@ -0,0 +1,107 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+func TestFindDuplicateResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests string
+		want      []string
+	}{
+		{
+			name: "no duplicates",
+			manifests: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: other
+`,
+			want: []string{},
+		},
+		{
+			name: "duplicates",
+			manifests: `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+  namespace: default
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`,
+			want: []string{
+				"core/Service /app: rendered 3 times",
+				"autoscaling/HorizontalPodAutoscaler default/app: rendered 2 times",
+			},
+		},
+		{
+			name: "chartsnap documents",
+			manifests: `apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: HelmStderr
+metadata:
+  name: stderr
+---
+apiVersion: helm-chartsnap.jlandowner.dev/v1alpha1
+kind: HelmStderr
+metadata:
+  name: stderr
+`,
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := yaml.Decode([]byte(tt.manifests))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0)
+			for _, f := range FindDuplicateResources(manifests) {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindDuplicateResources() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
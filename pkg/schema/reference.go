@@ -0,0 +1,325 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// DefaultExternalReferences are the references to the resources which exist in clusters without the chart.
+var DefaultExternalReferences = []string{
+	"ServiceAccount/default",
+	"ClusterRole/cluster-admin",
+	"ClusterRole/admin",
+	"ClusterRole/edit",
+	"ClusterRole/view",
+	"ClusterRole/system:*",
+}
+
+// ReferenceFinding is a reference from a rendered resource to a resource which is not rendered.
+type ReferenceFinding struct {
+	Kind string
+	Name string
+	// Message describes the broken reference.
+	Message string
+}
+
+func (f ReferenceFinding) String() string {
+	return fmt.Sprintf("%s/%s: %s", f.Kind, f.Name, f.Message)
+}
+
+// resource is a rendered resource decoded as a map.
+type resource struct {
+	kind      string
+	name      string
+	namespace string
+	obj       map[string]interface{}
+}
+
+// FindBrokenReferences checks the references between the rendered resources.
+//   - The selector of a Service matches the labels of some Pod template.
+//   - The backends of an Ingress point to the Services and their ports.
+//   - The ConfigMaps, Secrets, PersistentVolumeClaims and ServiceAccounts referred in Pod specs exist.
+//   - The Roles and ClusterRoles referred by RoleBindings and ClusterRoleBindings exist.
+//
+// The references to 'Kind/name' matching any of the external patterns or DefaultExternalReferences are not checked.
+// '*' matches any characters in a name. The optional references and the resources in other namespaces are not checked.
+func FindBrokenReferences(manifests []*kyaml.RNode, external []string) ([]ReferenceFinding, error) {
+	resources := make([]resource, 0, len(manifests))
+	for _, m := range manifests {
+		if m.GetKind() == "" || m.GetName() == "" {
+			continue
+		}
+		// decode via JSON to get the values of the JSON types which unstructured helpers expect
+		b, err := m.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s/%s: %w", m.GetKind(), m.GetName(), err)
+		}
+		obj := make(map[string]interface{})
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, fmt.Errorf("failed to decode %s/%s: %w", m.GetKind(), m.GetName(), err)
+		}
+		resources = append(resources, resource{kind: m.GetKind(), name: m.GetName(), namespace: m.GetNamespace(), obj: obj})
+	}
+
+	c := &referenceChecker{resources: resources, external: append(append([]string{}, DefaultExternalReferences...), external...)}
+	for _, r := range resources {
+		switch r.kind {
+		case "Service":
+			c.checkServiceSelector(r)
+		case "Ingress":
+			c.checkIngressBackends(r)
+		case "RoleBinding", "ClusterRoleBinding":
+			c.checkRoleRef(r)
+		}
+		if spec := podSpec(r); spec != nil {
+			c.checkPodSpec(r, spec)
+		}
+	}
+	return c.findings, nil
+}
+
+type referenceChecker struct {
+	resources []resource
+	external  []string
+	findings  []ReferenceFinding
+}
+
+func (c *referenceChecker) report(r resource, format string, args ...any) {
+	c.findings = append(c.findings, ReferenceFinding{Kind: r.kind, Name: r.name, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *referenceChecker) isExternal(kind, name string) bool {
+	for _, p := range c.external {
+		if ok, _ := path.Match(p, kind+"/"+name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the rendered resource of the kind and name in the namespace of the referrer.
+// The namespaces are regarded as the same if either is not set.
+func (c *referenceChecker) find(from resource, kind, name string) *resource {
+	for i, r := range c.resources {
+		if r.kind == kind && r.name == name && (r.namespace == "" || from.namespace == "" || r.namespace == from.namespace) {
+			return &c.resources[i]
+		}
+	}
+	return nil
+}
+
+// checkExists reports the reference if the resource is neither rendered nor external.
+func (c *referenceChecker) checkExists(from resource, kind, name, field string) {
+	if name == "" || c.isExternal(kind, name) || c.find(from, kind, name) != nil {
+		return
+	}
+	c.report(from, "%s %s/%s not found", field, kind, name)
+}
+
+func (c *referenceChecker) checkServiceSelector(svc resource) {
+	if t, _, _ := unstructured.NestedString(svc.obj, "spec", "type"); t == "ExternalName" {
+		return
+	}
+	selector, _, _ := unstructured.NestedStringMap(svc.obj, "spec", "selector")
+	if len(selector) == 0 || c.isExternal(svc.kind, svc.name) {
+		return
+	}
+	for _, r := range c.resources {
+		if r.namespace != "" && svc.namespace != "" && r.namespace != svc.namespace {
+			continue
+		}
+		if labels := podTemplateLabels(r); labels != nil && matchLabels(selector, labels) {
+			return
+		}
+	}
+	c.report(svc, "selector %s matches no Pod template", formatLabels(selector))
+}
+
+func (c *referenceChecker) checkIngressBackends(ing resource) {
+	backends := make([]map[string]interface{}, 0)
+	if b, ok, _ := unstructured.NestedMap(ing.obj, "spec", "defaultBackend"); ok {
+		backends = append(backends, b)
+	}
+	if b, ok, _ := unstructured.NestedMap(ing.obj, "spec", "backend"); ok {
+		backends = append(backends, b)
+	}
+	rules, _, _ := unstructured.NestedSlice(ing.obj, "spec", "rules")
+	for _, rule := range rules {
+		paths, _, _ := unstructured.NestedSlice(asMap(rule), "http", "paths")
+		for _, p := range paths {
+			if b, ok, _ := unstructured.NestedMap(asMap(p), "backend"); ok {
+				backends = append(backends, b)
+			}
+		}
+	}
+
+	for _, b := range backends {
+		// networking.k8s.io/v1 or v1beta1
+		name, _, _ := unstructured.NestedString(b, "service", "name")
+		port, _, _ := unstructured.NestedFieldNoCopy(b, "service", "port", "number")
+		if port == nil {
+			port, _, _ = unstructured.NestedFieldNoCopy(b, "service", "port", "name")
+		}
+		if name == "" {
+			name, _, _ = unstructured.NestedString(b, "serviceName")
+			port, _, _ = unstructured.NestedFieldNoCopy(b, "servicePort")
+		}
+		if name == "" || c.isExternal("Service", name) {
+			continue
+		}
+		svc := c.find(ing, "Service", name)
+		if svc == nil {
+			c.report(ing, "backend Service/%s not found", name)
+			continue
+		}
+		if port != nil && !hasServicePort(*svc, fmt.Sprint(port)) {
+			c.report(ing, "backend port %v not found in Service/%s", port, name)
+		}
+	}
+}
+
+func (c *referenceChecker) checkRoleRef(binding resource) {
+	kind, _, _ := unstructured.NestedString(binding.obj, "roleRef", "kind")
+	name, _, _ := unstructured.NestedString(binding.obj, "roleRef", "name")
+	c.checkExists(binding, kind, name, "roleRef")
+}
+
+func (c *referenceChecker) checkPodSpec(r resource, spec map[string]interface{}) {
+	if sa, _, _ := unstructured.NestedString(spec, "serviceAccountName"); sa != "" {
+		c.checkExists(r, "ServiceAccount", sa, "serviceAccountName")
+	}
+	secrets, _, _ := unstructured.NestedSlice(spec, "imagePullSecrets")
+	for _, s := range secrets {
+		name, _, _ := unstructured.NestedString(asMap(s), "name")
+		c.checkExists(r, "Secret", name, "imagePullSecrets")
+	}
+
+	volumes, _, _ := unstructured.NestedSlice(spec, "volumes")
+	for _, v := range volumes {
+		vol := asMap(v)
+		c.checkOptionalRef(r, vol, "ConfigMap", "name", "volume", "configMap")
+		c.checkOptionalRef(r, vol, "Secret", "secretName", "volume", "secret")
+		claim, _, _ := unstructured.NestedString(vol, "persistentVolumeClaim", "claimName")
+		c.checkExists(r, "PersistentVolumeClaim", claim, "volume")
+		sources, _, _ := unstructured.NestedSlice(vol, "projected", "sources")
+		for _, s := range sources {
+			c.checkOptionalRef(r, asMap(s), "ConfigMap", "name", "volume", "configMap")
+			c.checkOptionalRef(r, asMap(s), "Secret", "name", "volume", "secret")
+		}
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for _, ct := range containers {
+			env, _, _ := unstructured.NestedSlice(asMap(ct), "env")
+			for _, e := range env {
+				c.checkOptionalRef(r, asMap(e), "ConfigMap", "name", "env", "valueFrom", "configMapKeyRef")
+				c.checkOptionalRef(r, asMap(e), "Secret", "name", "env", "valueFrom", "secretKeyRef")
+			}
+			envFrom, _, _ := unstructured.NestedSlice(asMap(ct), "envFrom")
+			for _, e := range envFrom {
+				c.checkOptionalRef(r, asMap(e), "ConfigMap", "name", "envFrom", "configMapRef")
+				c.checkOptionalRef(r, asMap(e), "Secret", "name", "envFrom", "secretRef")
+			}
+		}
+	}
+}
+
+// checkOptionalRef checks the reference at the fields of the object unless it is optional.
+func (c *referenceChecker) checkOptionalRef(r resource, obj map[string]interface{}, kind, nameField, field string, fields ...string) {
+	ref, ok, _ := unstructured.NestedMap(obj, fields...)
+	if !ok {
+		return
+	}
+	if optional, _, _ := unstructured.NestedBool(ref, "optional"); optional {
+		return
+	}
+	name, _, _ := unstructured.NestedString(ref, nameField)
+	c.checkExists(r, kind, name, field)
+}
+
+// podSpec returns the Pod spec of the Pod or the Pod template of the workload.
+func podSpec(r resource) map[string]interface{} {
+	fields := podTemplateFields(r.kind)
+	if fields == nil {
+		return nil
+	}
+	if r.kind != "Pod" {
+		fields = append(fields, "template")
+	}
+	spec, ok, _ := unstructured.NestedMap(r.obj, append(fields, "spec")...)
+	if !ok {
+		return nil
+	}
+	return spec
+}
+
+// podTemplateLabels returns the labels of the Pod or the Pod template of the workload.
+func podTemplateLabels(r resource) map[string]string {
+	fields := podTemplateFields(r.kind)
+	if fields == nil {
+		return nil
+	}
+	if r.kind != "Pod" {
+		fields = append(fields, "template")
+	}
+	labels, _, _ := unstructured.NestedStringMap(r.obj, append(fields, "metadata", "labels")...)
+	return labels
+}
+
+// podTemplateFields returns the fields to the object which has the Pod template. nil if the kind has no Pod template.
+func podTemplateFields(kind string) []string {
+	switch kind {
+	case "Pod":
+		return []string{}
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		return []string{"spec"}
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec"}
+	default:
+		return nil
+	}
+}
+
+func hasServicePort(svc resource, port string) bool {
+	ports, _, _ := unstructured.NestedSlice(svc.obj, "spec", "ports")
+	for _, p := range ports {
+		if fmt.Sprint(asMap(p)["port"]) == port || fmt.Sprint(asMap(p)["name"]) == port {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
@@ -0,0 +1,278 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+func TestFindBrokenReferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests string
+		external  []string
+		want      []string
+	}{
+		{
+			name: "valid references",
+			manifests: `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secret
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: app-data
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+        tier: web
+    spec:
+      serviceAccountName: app
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: app-config
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: app-secret
+              key: password
+        - name: OPTIONAL
+          valueFrom:
+            configMapKeyRef:
+              name: optional-config
+              key: value
+              optional: true
+      volumes:
+      - name: data
+        persistentVolumeClaim:
+          claimName: app-data
+      - name: config
+        configMap:
+          name: app-config
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - name: http
+    port: 80
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: app
+            port:
+              number: 80
+      - path: /api
+        backend:
+          service:
+            name: app
+            port:
+              name: http
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+roleRef:
+  kind: Role
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: app-view
+roleRef:
+  kind: ClusterRole
+  name: view
+`,
+			want: []string{},
+		},
+		{
+			name: "broken references",
+			manifests: `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        metadata:
+          labels:
+            app: job
+        spec:
+          serviceAccountName: job
+          imagePullSecrets:
+          - name: registry
+          containers:
+          - name: job
+            envFrom:
+            - secretRef:
+                name: job-secret
+          volumes:
+          - name: projected
+            projected:
+              sources:
+              - configMap:
+                  name: job-config
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+  ports:
+  - port: 80
+---
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  backend:
+    serviceName: missing
+    servicePort: 80
+  rules:
+  - http:
+      paths:
+      - backend:
+          serviceName: app
+          servicePort: 8080
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: app
+roleRef:
+  kind: Role
+  name: app
+`,
+			want: []string{
+				"CronJob/job: serviceAccountName ServiceAccount/job not found",
+				"CronJob/job: imagePullSecrets Secret/registry not found",
+				"CronJob/job: volume ConfigMap/job-config not found",
+				"CronJob/job: envFrom Secret/job-secret not found",
+				"Service/app: selector app=app matches no Pod template",
+				"Ingress/app: backend Service/missing not found",
+				"Ingress/app: backend port 8080 not found in Service/app",
+				"RoleBinding/app: roleRef Role/app not found",
+			},
+		},
+		{
+			name: "external references",
+			manifests: `apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  serviceAccountName: default
+  containers:
+  - name: app
+  volumes:
+  - name: tls
+    secret:
+      secretName: tls-app
+  - name: data
+    persistentVolumeClaim:
+      claimName: shared-data
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: auth-delegator
+roleRef:
+  kind: ClusterRole
+  name: system:auth-delegator
+`,
+			external: []string{"Secret/tls-*", "PersistentVolumeClaim/shared-data"},
+			want:     []string{},
+		},
+		{
+			name: "different namespaces",
+			manifests: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: other
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+  namespace: default
+spec:
+  containers:
+  - name: app
+    envFrom:
+    - configMapRef:
+        name: config
+`,
+			want: []string{
+				"Pod/app: envFrom ConfigMap/config not found",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := yaml.Decode([]byte(tt.manifests))
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings, err := FindBrokenReferences(manifests, tt.external)
+			if err != nil {
+				t.Fatalf("FindBrokenReferences() error = %v", err)
+			}
+			got := make([]string, 0, len(findings))
+			for _, f := range findings {
+				got = append(got, f.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindBrokenReferences() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	logger *slog.Logger
+	mu     sync.Mutex
+)
+
+func SetLogger(slogr *slog.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	logger = slogr
+}
+
+func log() *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger
+}
+
+// strict deserializer of the built-in Kubernetes types bundled in client-go.
+var builtinDecoder = serializer.NewCodecFactory(scheme.Scheme, serializer.EnableStrict).UniversalDeserializer()
+
+// ValidationError is a schema violation of a rendered resource.
+type ValidationError struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Message    string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s %s/%s: %s", e.APIVersion, e.Kind, e.Name, e.Message)
+}
+
+// Validator validates the rendered manifests against the Kubernetes schemas without network.
+//
+// The JSON schemas in SchemaDirs are looked up in the same layout as kubeconform, e.g.
+// 'SCHEMA_DIR/v1.29.0-standalone-strict/deployment-apps-v1.json' or 'SCHEMA_DIR/deployment-apps-v1.json'.
+// If no schema file is found, the built-in types bundled in chartsnap are strictly decoded
+// to report unknown fields and type errors.
+// Custom resources are validated against the schemas of the CustomResourceDefinitions added by AddCRDs or AddCRDDir.
+// ValidateCustomResources validates only the custom resources whose CustomResourceDefinitions are added.
+type Validator struct {
+	// SchemaDirs are the directories of the JSON schemas.
+	SchemaDirs []string
+	// KubeVersion is the target Kubernetes version like '1.29.0' or '1.29' to pick the schema directory.
+	KubeVersion string
+
+	mu      sync.Mutex
+	schemas map[string]*spec.Schema
+	crds    map[string]*spec.Schema
+}
+
+// Validate validates the resources and returns the violations.
+// Documents which are not Kubernetes resources are ignored.
+// Resources whose schema is not found are reported in the debug logs and skipped.
+func (v *Validator) Validate(manifests []*kyaml.RNode) ([]ValidationError, error) {
+	errs := make([]ValidationError, 0)
+	for _, m := range manifests {
+		apiVersion, kind := m.GetApiVersion(), m.GetKind()
+		if apiVersion == "" || kind == "" {
+			continue
+		}
+		ve := ValidationError{APIVersion: apiVersion, Kind: kind, Name: m.GetName()}
+
+		raw, err := m.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s/%s: %w", ve.APIVersion, ve.Kind, ve.Name, err)
+		}
+
+		s := v.crdSchema(apiVersion, kind)
+		if s == nil {
+			if s, err = v.schema(apiVersion, kind); err != nil {
+				return nil, err
+			}
+		}
+		if s != nil {
+			violations, err := validateBySchema(ve, raw, s)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, violations...)
+			continue
+		}
+
+		if _, _, err := builtinDecoder.Decode(raw, nil, nil); err != nil {
+			if runtime.IsNotRegisteredError(err) {
+				log().Debug("schema not found. skipped", "apiVersion", apiVersion, "kind", kind, "name", ve.Name)
+				continue
+			}
+			ve.Message = err.Error()
+			errs = append(errs, ve)
+		}
+	}
+	return errs, nil
+}
+
+// ValidateCustomResources validates only the custom resources against the schemas of the CustomResourceDefinitions
+// added by AddCRDs or AddCRDDir and returns the violations. The other resources are ignored.
+func (v *Validator) ValidateCustomResources(manifests []*kyaml.RNode) ([]ValidationError, error) {
+	errs := make([]ValidationError, 0)
+	for _, m := range manifests {
+		apiVersion, kind := m.GetApiVersion(), m.GetKind()
+		s := v.crdSchema(apiVersion, kind)
+		if s == nil {
+			continue
+		}
+		ve := ValidationError{APIVersion: apiVersion, Kind: kind, Name: m.GetName()}
+
+		raw, err := m.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s %s/%s: %w", ve.APIVersion, ve.Kind, ve.Name, err)
+		}
+		violations, err := validateBySchema(ve, raw, s)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, violations...)
+	}
+	return errs, nil
+}
+
+// validateBySchema returns the violations of the resource against the schema.
+func validateBySchema(ve ValidationError, raw []byte, s *spec.Schema) ([]ValidationError, error) {
+	var obj any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	// sort the errors of the resource since the validator reports them in random order
+	messages := make([]string, 0)
+	for _, e := range validate.NewSchemaValidator(s, nil, "", strfmt.Default).Validate(obj).Errors {
+		messages = append(messages, e.Error())
+	}
+	sort.Strings(messages)
+	errs := make([]ValidationError, 0, len(messages))
+	for _, msg := range messages {
+		ve.Message = msg
+		errs = append(errs, ve)
+	}
+	return errs, nil
+}
+
+// schema returns the JSON schema of the resource in SchemaDirs or nil if not found.
+func (v *Validator) schema(apiVersion, kind string) (*spec.Schema, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.schemas == nil {
+		v.schemas = make(map[string]*spec.Schema)
+	}
+	key := apiVersion + "/" + kind
+	if s, ok := v.schemas[key]; ok {
+		return s, nil
+	}
+
+	var found *spec.Schema
+	for _, f := range v.schemaFiles(apiVersion, kind) {
+		b, err := os.ReadFile(f)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read schema: %w", err)
+		}
+		found = &spec.Schema{}
+		if err := json.Unmarshal(b, found); err != nil {
+			return nil, fmt.Errorf("failed to decode schema '%s': %w", f, err)
+		}
+		log().Debug("schema loaded", "apiVersion", apiVersion, "kind", kind, "path", f)
+		break
+	}
+	v.schemas[key] = found
+	return found, nil
+}
+
+// schemaFiles returns the candidates of the schema file paths in the order of priority.
+func (v *Validator) schemaFiles(apiVersion, kind string) []string {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil
+	}
+	name := strings.ToLower(kind)
+	if gv.Group != "" {
+		name += "-" + strings.Split(gv.Group, ".")[0]
+	}
+	name += "-" + gv.Version + ".json"
+
+	version := schemaVersion(v.KubeVersion)
+	files := make([]string, 0)
+	for _, dir := range v.SchemaDirs {
+		files = append(files,
+			filepath.Join(dir, version+"-standalone-strict", name),
+			filepath.Join(dir, version+"-standalone", name),
+			filepath.Join(dir, name))
+	}
+	return files
+}
+
+// schemaVersion returns the version in the schema directory names of kubeconform like 'v1.29.0'.
+// The version like '1.29' is normalized to major.minor.patch. It returns 'master' if the version is empty.
+func schemaVersion(kubeVersion string) string {
+	if kubeVersion == "" {
+		return "master"
+	}
+	if v, err := version.ParseGeneric(kubeVersion); err == nil {
+		return fmt.Sprintf("v%d.%d.%d", v.Major(), v.Minor(), v.Patch())
+	}
+	return "v" + strings.TrimPrefix(kubeVersion, "v")
+}
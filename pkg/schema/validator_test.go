@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/yaml"
+)
+
+func TestSchema(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Schema Suite")
+}
+
+func load(file string) []*kyaml.RNode {
+	b, err := os.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	manifests, err := yaml.Decode(b)
+	Expect(err).NotTo(HaveOccurred())
+	return manifests
+}
+
+var _ = Describe("Validator", func() {
+	It("should pass valid manifests", func() {
+		v := &Validator{SchemaDirs: []string{"testdata/schemas"}, KubeVersion: "1.29.0"}
+		errs, err := v.Validate(load("testdata/valid.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errs).To(BeEmpty())
+	})
+
+	It("should report unknown fields and type errors by the schema files and the built-in types", func() {
+		v := &Validator{SchemaDirs: []string{"testdata/schemas"}, KubeVersion: "v1.29.0"}
+		errs, err := v.Validate(load("testdata/invalid.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+
+		messages := make([]string, 0, len(errs))
+		for _, e := range errs {
+			messages = append(messages, e.Error())
+		}
+		Ω(messages).To(MatchSnapShot())
+	})
+
+	It("should pick the schema directory of the version without the patch version", func() {
+		want, err := (&Validator{SchemaDirs: []string{"testdata/schemas"}, KubeVersion: "1.29.0"}).Validate(load("testdata/invalid.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		errs, err := (&Validator{SchemaDirs: []string{"testdata/schemas"}, KubeVersion: "1.29"}).Validate(load("testdata/invalid.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errs).To(Equal(want))
+	})
+
+	It("should validate only the built-in types if the schema is not found for the version", func() {
+		v := &Validator{SchemaDirs: []string{"testdata/schemas"}, KubeVersion: "1.30.0"}
+		errs, err := v.Validate(load("testdata/invalid.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[2].Kind).To(Equal("ConfigMap"))
+		Expect(errs[2].Message).To(ContainSubstring("cannot unmarshal string"))
+	})
+
+	Context("custom resources", func() {
+		It("should validate custom resources against the CRDs in the directory", func() {
+			v := &Validator{}
+			Expect(v.AddCRDDir("testdata/crds")).To(Succeed())
+			errs, err := v.Validate(load("testdata/widgets.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+
+			messages := make([]string, 0, len(errs))
+			for _, e := range errs {
+				Expect(e.Name).To(Equal("invalid"))
+				messages = append(messages, e.Error())
+			}
+			Ω(messages).To(MatchSnapShot())
+		})
+
+		It("should validate custom resources against the CRDs in the manifests", func() {
+			v := &Validator{}
+			manifests := append(load("testdata/crds/widget.yaml"), load("testdata/widgets.yaml")...)
+			Expect(v.AddCRDs(manifests)).To(Succeed())
+			errs, err := v.Validate(manifests)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errs).To(HaveLen(4))
+		})
+
+		It("should keep the schemas open where the fields are declared elsewhere", func() {
+			v := &Validator{}
+			Expect(v.AddCRDDir("testdata/crds")).To(Succeed())
+			errs, err := v.ValidateCustomResources(load("testdata/gadgets.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+
+			messages := make([]string, 0, len(errs))
+			for _, e := range errs {
+				Expect(e.Name).To(Equal("invalid"))
+				messages = append(messages, e.Error())
+			}
+			Ω(messages).To(MatchSnapShot())
+		})
+
+		It("should validate only custom resources by ValidateCustomResources", func() {
+			v := &Validator{}
+			errs, err := v.ValidateCustomResources(load("testdata/gadgets.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errs).To(BeEmpty())
+
+			errs, err = v.Validate(load("testdata/gadgets.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Kind).To(Equal("ConfigMap"))
+		})
+
+		It("should skip custom resources without CRDs", func() {
+			v := &Validator{}
+			Expect(v.AddCRDDir("testdata/not-found")).To(Succeed())
+			errs, err := v.Validate(load("testdata/widgets.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errs).To(BeEmpty())
+		})
+	})
+})
@@ -54,6 +54,14 @@ func WithDiffFunc(f DiffFunc) Option {
 	}
 }
 
+// WithEqualFunc is an option to specify how to compare the actual value with the snapshot.
+// By default, they are compared as strings.
+func WithEqualFunc(f EqualFunc) Option {
+	return func(m *snapshotMatcher) {
+		m.equalFunc = f
+	}
+}
+
 // WithSnapshotID is an option to specify the snapshot ID. If this option is set, the snapshot file is treated as a multi-snapshot file.
 func WithSnapshotID(id string) Option {
 	return func(m *snapshotMatcher) {
@@ -66,6 +74,7 @@ func SnapshotMatcher(snapFile string, options ...Option) *snapshotMatcher {
 	m := &snapshotMatcher{
 		snapFilePath: snapFile,
 		diffFunc:     defaultDiffFunc,
+		equalFunc:    defaultEqualFunc,
 	}
 
 	for _, opt := range options {
@@ -76,12 +85,19 @@ func SnapshotMatcher(snapFile string, options ...Option) *snapshotMatcher {
 
 type DiffFunc func(x, y string) string
 
+type EqualFunc func(expected, actual string) bool
+
+func defaultEqualFunc(expected, actual string) bool {
+	return expected == actual
+}
+
 type snapshotMatcher struct {
 	snapFilePath   string
 	snapID         string
 	expectedString string
 	actualString   string
 	diffFunc       DiffFunc
+	equalFunc      EqualFunc
 }
 
 func (m *snapshotMatcher) Match(actual interface{}) (success bool, err error) {
@@ -116,7 +132,7 @@ func (m *snapshotMatcher) Match(actual interface{}) (success bool, err error) {
 	}
 	m.expectedString = string(snap)
 
-	return m.actualString == m.expectedString, nil
+	return m.equalFunc(m.expectedString, m.actualString), nil
 }
 
 // FailureMessage returns a string that describes the failure of the matcher.
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -94,6 +95,34 @@ Namespaces are one honking great idea -- let's do more of those!
 			})
 		})
 
+		Context("snapshot file exist with equal func", func() {
+			It("match snapshot by equal func", func() {
+				var (
+					snapFile     = "single.snap"
+					snapFilePath = filepath.Join(pwd, "__snapshot__", snapFile)
+				)
+
+				fileContent, err := os.ReadFile(snapFilePath)
+				Expect(err).NotTo(HaveOccurred())
+
+				ignoreFirstLine := func(expected, actual string) bool {
+					_, e, _ := strings.Cut(expected, "\n")
+					_, a, _ := strings.Cut(actual, "\n")
+					return e == a
+				}
+
+				matcher := SnapshotMatcher(snapFilePath, WithEqualFunc(ignoreFirstLine))
+				success, err := matcher.Match("changed first line\n" + strings.SplitN(string(fileContent), "\n", 2)[1])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(success).To(BeTrue())
+
+				matcher = SnapshotMatcher(snapFilePath)
+				success, err = matcher.Match("changed first line\n" + strings.SplitN(string(fileContent), "\n", 2)[1])
+				Expect(err).NotTo(HaveOccurred())
+				Expect(success).To(BeFalse())
+			})
+		})
+
 		Context("multi-formatted snapshot file exist", func() {
 			It("match snapshot", func() {
 				var (
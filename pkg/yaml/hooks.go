@@ -0,0 +1,103 @@
+package yaml
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const (
+	HookAnnotation       = "helm.sh/hook"
+	HookWeightAnnotation = "helm.sh/hook-weight"
+)
+
+// hookPhases is the order of helm hook phases
+// https://helm.sh/docs/topics/charts_hooks/#the-available-hooks
+var hookPhases = []string{
+	"pre-install", "post-install",
+	"pre-delete", "post-delete",
+	"pre-upgrade", "post-upgrade",
+	"pre-rollback", "post-rollback",
+	"test", "test-success",
+}
+
+type hook struct {
+	doc    *yaml.RNode
+	phases []string
+	weight int
+}
+
+func (h hook) order() int {
+	return phaseOrder(h.phases[0])
+}
+
+func phaseOrder(phase string) int {
+	i := slices.Index(hookPhases, phase)
+	if i < 0 {
+		return len(hookPhases)
+	}
+	return i
+}
+
+func (h hook) comment() string {
+	return fmt.Sprintf("# Hook: %s weight=%d", strings.Join(h.phases, ","), h.weight)
+}
+
+// GroupHooks moves hook resources after the other resources.
+// Hook resources are grouped by hook phases and sorted by hook weights,
+// and a comment describing the hook phases and weight is added to each of them.
+func GroupHooks(docs []*yaml.RNode) []*yaml.RNode {
+	out := make([]*yaml.RNode, 0, len(docs))
+	hooks := make([]hook, 0)
+	for _, doc := range docs {
+		v, ok := doc.GetAnnotations()[HookAnnotation]
+		if !ok || strings.TrimSpace(v) == "" {
+			out = append(out, doc)
+			continue
+		}
+		h := hook{doc: doc}
+		for _, p := range strings.Split(v, ",") {
+			h.phases = append(h.phases, strings.TrimSpace(p))
+		}
+		sort.SliceStable(h.phases, func(i, j int) bool {
+			return phaseOrder(h.phases[i]) < phaseOrder(h.phases[j])
+		})
+		if w, err := strconv.Atoi(doc.GetAnnotations()[HookWeightAnnotation]); err == nil {
+			h.weight = w
+		}
+		hooks = append(hooks, h)
+	}
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].order() != hooks[j].order() {
+			return hooks[i].order() < hooks[j].order()
+		}
+		if pi, pj := strings.Join(hooks[i].phases, ","), strings.Join(hooks[j].phases, ","); pi != pj {
+			return pi < pj
+		}
+		return hooks[i].weight < hooks[j].weight
+	})
+
+	for _, h := range hooks {
+		addHeadComment(h.doc, h.comment())
+		out = append(out, h.doc)
+	}
+	return out
+}
+
+// addHeadComment adds the comment to the head of the document next to the '# Source:' comment.
+func addHeadComment(doc *yaml.RNode, comment string) {
+	n := doc.YNode()
+	if n.Kind == yaml.MappingNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if n.HeadComment == "" {
+		n.HeadComment = comment
+	} else {
+		n.HeadComment = n.HeadComment + "\n" + comment
+	}
+}
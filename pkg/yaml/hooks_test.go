@@ -0,0 +1,34 @@
+package yaml
+
+import (
+	. "github.com/jlandowner/helm-chartsnap/pkg/snap/gomega"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var _ = Describe("GroupHooks", func() {
+	It("should move hooks to the end grouped by phases and sorted by weights", func() {
+		manifests := GroupHooks(load("testdata/input_hooks.yaml"))
+
+		buf, err := Encode(manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Ω(buf).Should(MatchSnapShot())
+	})
+
+	It("should not change manifests without hooks", func() {
+		manifests := make([]*yaml.RNode, 0)
+		for _, doc := range load("testdata/input.yaml") {
+			if _, ok := doc.GetAnnotations()[HookAnnotation]; !ok {
+				manifests = append(manifests, doc)
+			}
+		}
+		grouped := GroupHooks(manifests)
+
+		want, err := Encode(manifests)
+		Expect(err).NotTo(HaveOccurred())
+		got, err := Encode(grouped)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(want))
+	})
+})
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newRenderCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render (-c CHART | --stdin | FILE)",
+		Short: "Print the normalized manifests without matching snapshots",
+		Long: `
+Print the normalized manifests without matching snapshots.
+
+The manifests are rendered by 'helm template' or read from stdin or a file,
+and the dynamic fields in the config file or testSpec are replaced with fixed values.
+The output is the same as the snapshot contents so that it can be fed into other tools like linters.
+`,
+		Example: `
+  # Print the normalized manifests of the chart with test case values:
+  chartsnap render -c YOUR_CHART -f YOUR_TEST_VALUES_FILE
+
+  # Set additional args or flags for the 'helm template' command:
+  chartsnap render -c YOUR_CHART -f YOUR_TEST_VALUES_FILE -- --skip-tests
+
+  # Normalize manifests piped from other tools and validate them:
+  helm template RELEASE_NAME YOUR_CHART | chartsnap render --stdin | kubeconform`,
+		Annotations: map[string]string{logToStderrAnnotation: "true"},
+		RunE:        runRender,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory. this flag is passed to 'helm template RELEASE_NAME CHART --values VALUES' as 'CHART'")
+	if err := cmd.MarkFlagDirname("chart"); err != nil {
+		panic(err)
+	}
+	cmd.Flags().BoolVar(&o.Stdin, "stdin", false, "read manifests from stdin")
+	return cmd
+}
+
+func runRender(cmd *cobra.Command, args []string) error {
+	// args after dash are passed to 'helm template' command
+	fileArgs, helmArgs := args, []string{}
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		fileArgs, helmArgs = args[:dash], args[dash:]
+	}
+
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+
+	snapshotter := charts.ChartSnapshotter{
+		SnapshotConfig: cfg,
+		FailHelmError:  o.FailHelmError,
+	}
+
+	if o.Chart != "" {
+		if o.Stdin || len(fileArgs) > 0 {
+			return fmt.Errorf("--chart cannot be specified with --stdin or FILE")
+		}
+		if stat, err := os.Stat(o.ValuesFile); err == nil && stat.IsDir() {
+			return fmt.Errorf("values file '%s' is a directory. specify a values file", o.ValuesFile)
+		}
+		if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+			return err
+		}
+		chart, templateArgs, err := fetchChart(cmd.Context(), o.Chart, helmArgs)
+		if err != nil {
+			return err
+		}
+		snapshotter.HelmTemplateCmdOptions = charts.HelmTemplateCmdOptions{
+			HelmPath:       o.HelmBin(),
+			ReleaseName:    o.ReleaseName,
+			Namespace:      o.Namespace(),
+			Chart:          chart,
+			ValuesFile:     o.ValuesFile,
+			AdditionalArgs: templateArgs,
+		}
+	} else {
+		renderer, err := inputRenderer(cmd, fileArgs)
+		if err != nil {
+			return err
+		}
+		snapshotter.Renderer = renderer
+	}
+
+	out, err := snapshotter.Render(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to render manifests: %w", err)
+	}
+	_, err = cmd.OutOrStdout().Write(out)
+	return err
+}
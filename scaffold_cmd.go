@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newScaffoldCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scaffold -c CHART -o OUTPUT_DIR",
+		Short: "Generate test values files from the feature toggles in values.yaml and take the initial snapshots",
+		Long: `
+Generate test values files from the feature toggles in values.yaml and take the initial snapshots.
+
+The boolean values named 'enabled', 'create' or 'tls' in the chart's values.yaml are regarded as feature toggles.
+A test values file flipping each toggle and 'test_all_enabled.yaml' turning on all the disabled toggles are written into OUTPUT_DIR.
+Each test case is rendered twice and the fields which differ are written as the dynamicFields of a starter '.chartsnap.yaml'.
+The existing files are not overwritten.
+`,
+		Example: `
+  # Onboard your chart to snapshot testing:
+  chartsnap scaffold -c YOUR_CHART -o YOUR_CHART/tests
+
+  # Onboard a remote chart:
+  chartsnap scaffold -c ingress-nginx -o tests/ingress-nginx -- --repo https://kubernetes.github.io/ingress-nginx`,
+		RunE: runScaffold,
+	}
+	cmd.Flags().StringVarP(&o.Chart, "chart", "c", "", "path to the chart directory or remote chart name")
+	if err := cmd.MarkFlagRequired("chart"); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+func runScaffold(cmd *cobra.Command, args []string) error {
+	if o.OutputDir == "" {
+		return fmt.Errorf("--output-dir is required to write the test values files")
+	}
+
+	if err := buildDependencies(cmd.Context(), o.Chart); err != nil {
+		return err
+	}
+	chart, helmArgs, err := fetchChart(cmd.Context(), o.Chart, args)
+	if err != nil {
+		return err
+	}
+
+	toggles, err := charts.FeatureToggles(chart)
+	if err != nil {
+		return err
+	}
+	files, err := charts.ScaffoldValuesFiles(toggles)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(o.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	values := []string{""}
+	for _, f := range files {
+		p := path.Join(o.OutputDir, f.Name)
+		values = append(values, p)
+		if writeIfNotExist(p, f.Content) {
+			log.Info("test values file written", "path", p)
+		}
+	}
+
+	cfgFile := path.Join(o.OutputDir, o.ConfigFile)
+	if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
+		fields := detectDynamicFields(cmd.Context(), chart, helmArgs, values)
+		b, err := charts.ScaffoldConfig(fields)
+		if err != nil {
+			return err
+		}
+		if writeIfNotExist(cfgFile, b) {
+			log.Info("config file written", "path", cfgFile, "dynamicFields", len(fields))
+		}
+	} else {
+		log.Info("config file already exists. skipped", "path", cfgFile)
+	}
+
+	// take the initial snapshots of all test values files in the output directory
+	o.ValuesFile = o.OutputDir
+	return run(cmd, args)
+}
+
+// writeIfNotExist writes the file and returns true unless the file already exists.
+func writeIfNotExist(file string, data []byte) bool {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		log.Info("file already exists. skipped", "path", file, "err", err)
+		return false
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		log.Warn("failed to write file", "path", file, "err", err)
+		return false
+	}
+	return true
+}
+
+// detectDynamicFields renders each test case twice and returns the fields which differ.
+func detectDynamicFields(ctx context.Context, chart string, helmArgs []string, values []string) []v1alpha1.ManifestPath {
+	fields := make([]v1alpha1.ManifestPath, 0)
+	for _, v := range values {
+		ht := charts.HelmTemplateCmdOptions{
+			HelmPath:       o.HelmBin(),
+			ReleaseName:    o.ReleaseName,
+			Namespace:      o.Namespace(),
+			Chart:          chart,
+			ValuesFile:     v,
+			AdditionalArgs: helmArgs,
+		}
+		x, err := ht.Execute(ctx)
+		if err != nil {
+			log.Warn("failed to render. skipped detecting dynamic fields", "values", v, "err", err)
+			continue
+		}
+		y, err := ht.Execute(ctx)
+		if err != nil {
+			log.Warn("failed to render. skipped detecting dynamic fields", "values", v, "err", err)
+			continue
+		}
+		detected, err := charts.DetectDynamicFields(x.Stdout, y.Stdout)
+		if err != nil {
+			log.Warn("failed to detect dynamic fields", "values", v, "err", err)
+			continue
+		}
+		fields = append(fields, detected...)
+	}
+	return charts.MergeDynamicFields(fields...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/jlandowner/helm-chartsnap/pkg/api/v1alpha1"
+	"github.com/jlandowner/helm-chartsnap/pkg/charts"
+)
+
+func newSnapCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snap --name NAME (--stdin | FILE)",
+		Short: "Snapshot testing for arbitrary manifests read from stdin or a file",
+		Long: `
+Snapshot testing for arbitrary manifests read from stdin or a file.
+
+The manifests are decoded, the dynamic fields in the config file are replaced with fixed values
+and the result is matched with the snapshot OUTPUT_DIR/__snapshots__/NAME.snap.
+It composes snapshot testing with other tools by pipes.
+`,
+		Example: `
+  # Snapshot manifests piped from other tools:
+  helm template RELEASE_NAME YOUR_CHART | yq 'del(.metadata.labels)' | chartsnap snap --stdin --name YOUR_SNAPSHOT_NAME -o YOUR_OUTPUT_DIR
+
+  # Snapshot pre-rendered manifests file:
+  chartsnap snap --name YOUR_SNAPSHOT_NAME YOUR_MANIFESTS_FILE`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runSnap,
+	}
+	cmd.Flags().BoolVar(&o.Stdin, "stdin", false, "read manifests from stdin")
+	cmd.Flags().StringVar(&o.SnapshotName, "name", "", "snapshot name. the snapshot file is created as OUTPUT_DIR/__snapshots__/NAME.snap")
+	if err := cmd.MarkFlagRequired("name"); err != nil {
+		panic(err)
+	}
+	return cmd
+}
+
+// inputRenderer returns a renderer reading manifests from stdin or the file in args
+func inputRenderer(cmd *cobra.Command, args []string) (charts.Renderer, error) {
+	switch {
+	case o.Stdin && len(args) > 0:
+		return nil, fmt.Errorf("--stdin and FILE cannot be specified at the same time")
+	case o.Stdin:
+		return &charts.ReaderRenderer{Reader: cmd.InOrStdin(), Source: "stdin"}, nil
+	case len(args) > 0:
+		return &charts.FileRenderer{Path: args[0]}, nil
+	default:
+		return nil, fmt.Errorf("either --stdin or FILE is required")
+	}
+}
+
+func runSnap(cmd *cobra.Command, args []string) error {
+	renderer, err := inputRenderer(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	var cfg v1alpha1.SnapshotConfig
+	if err := loadDefaultSnapshotConfig(&cfg); err != nil {
+		return err
+	}
+
+	outputDir := o.OutputDir
+	if outputDir == "" {
+		outputDir = "."
+	}
+
+	snapshotter := charts.ChartSnapshotter{
+		Renderer:           renderer,
+		SnapshotConfig:     cfg,
+		SnapshotFile:       path.Join(outputDir, "__snapshots__", o.SnapshotName+".snap"),
+		SnapshotVersion:    o.snapshotVersion(),
+		DiffContextLineN:   o.DiffContextLineN,
+		UpdateSnapshot:     o.UpdateSnapshot,
+		HeaderVersion:      version,
+		FailHelmError:      o.FailHelmError,
+		ValidateSchema:     o.ValidateSchema,
+		SchemaDirs:         o.SchemaDirs,
+		ValidateCRDs:       o.ValidateCRDs,
+		CRDDirs:            o.CRDDirs,
+		ValidateReferences: o.ValidateReferences,
+		TargetKubeVersion:  o.TargetKubeVersion,
+		DeprecatedAPI:      o.DeprecatedAPI,
+		DuplicateResource:  o.DuplicateResource,
+	}
+
+	testCase := fmt.Sprintf("name=%s source=%s", o.SnapshotName, renderer.Name())
+	bannerPrintln("RUNS", fmt.Sprintf("Snapshot testing %s", testCase), 0, color.BgBlue)
+
+	result, err := snapshotter.Snap(cmd.Context())
+	if err != nil {
+		bannerPrintln("FAIL", fmt.Sprintf("%s err=%v snapshot_version=%s", testCase, err, snapshotter.SnapshotVersion), color.FgRed, color.BgRed)
+		return fmt.Errorf("failed to get snapshot %s: %w", testCase, err)
+	}
+	if !result.Match {
+		bannerPrintln("FAIL", fmt.Sprintf("Snapshot does not match %s snapshot_version=%s", testCase, snapshotter.SnapshotVersion), color.FgRed, color.BgRed)
+		fmt.Println(result.FailureMessage)
+		return fmt.Errorf("snapshot does not match %s", testCase)
+	}
+	bannerPrintln("PASS", fmt.Sprintf("Snapshot %s %s snapshot_version=%s", o.OK(), testCase, snapshotter.SnapshotVersion), color.FgGreen, color.BgGreen)
+	return nil
+}